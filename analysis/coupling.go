@@ -0,0 +1,216 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package analysis computes metrics over the history of repositories, from
+// the commits and deltas fetched by the repo package.
+package analysis
+
+import (
+	"sort"
+
+	"github.com/DevMine/repotool/model"
+)
+
+// Coupling represents how often two files change together, which is known as
+// change coupling. Files are identified by their latest path, renames being
+// followed.
+type Coupling struct {
+	// File is the path of the file changed by the fewest commits of the
+	// pair.
+	File string `json:"file"`
+
+	// CoupledFile is the path of the other file of the pair.
+	CoupledFile string `json:"coupled_file"`
+
+	// Commits is the number of commits changing both files.
+	Commits int `json:"commits"`
+
+	// FileCommits is the number of commits changing File.
+	FileCommits int `json:"file_commits"`
+
+	// CoupledFileCommits is the number of commits changing CoupledFile.
+	CoupledFileCommits int `json:"coupled_file_commits"`
+
+	// Support is the proportion, between 0 and 1, of the analyzed commits
+	// which change both files.
+	Support float64 `json:"support"`
+
+	// Confidence is the proportion, between 0 and 1, of the commits changing
+	// File which also change CoupledFile.
+	Confidence float64 `json:"confidence"`
+
+	// ReverseConfidence is the proportion, between 0 and 1, of the commits
+	// changing CoupledFile which also change File.
+	ReverseConfidence float64 `json:"reverse_confidence"`
+}
+
+// filePair is a pair of files, the first one having the smallest path.
+type filePair struct {
+	a, b string
+}
+
+// ChangeCoupling computes the change coupling of the files changed by
+// commits, which must come with their deltas and be in topological order,
+// every commit before its parents, as fetched by the repo package. Commits
+// changing more than maxFiles files, such as mass reformattings or imports,
+// are left out, unless maxFiles is 0. Pairs of files changed together by fewer than minCommits
+// commits are left out as well. Couplings are sorted by decreasing support,
+// then by decreasing confidence.
+func ChangeCoupling(commits []model.Commit, maxFiles, minCommits int) []Coupling {
+	var total int
+	fileCommits := make(map[string]int)
+	pairCommits := make(map[filePair]int)
+
+	tracker := newRenameTracker()
+	for _, c := range commits {
+		files := tracker.files(c)
+		if maxFiles > 0 && len(files) > maxFiles {
+			continue
+		}
+
+		total++
+		for i, a := range files {
+			fileCommits[a]++
+			for _, b := range files[i+1:] {
+				pairCommits[filePair{a, b}]++
+			}
+		}
+	}
+
+	couplings := make([]Coupling, 0)
+	for p, n := range pairCommits {
+		if n < minCommits {
+			continue
+		}
+
+		c := Coupling{
+			File:               p.a,
+			CoupledFile:        p.b,
+			Commits:            n,
+			FileCommits:        fileCommits[p.a],
+			CoupledFileCommits: fileCommits[p.b],
+		}
+		if c.CoupledFileCommits < c.FileCommits {
+			c.File, c.CoupledFile = c.CoupledFile, c.File
+			c.FileCommits, c.CoupledFileCommits = c.CoupledFileCommits, c.FileCommits
+		}
+		c.Support = float64(n) / float64(total)
+		c.Confidence = float64(n) / float64(c.FileCommits)
+		c.ReverseConfidence = float64(n) / float64(c.CoupledFileCommits)
+
+		couplings = append(couplings, c)
+	}
+
+	sort.Sort(bySupport(couplings))
+	return couplings
+}
+
+// renameTracker maps the paths of files, as they were when commits were
+// made, to their latest paths. Commits must be given before their parents:
+// commit dates cannot be relied on, as they may be off or rewritten by
+// rebases.
+type renameTracker struct {
+	names map[string]string
+}
+
+func newRenameTracker() *renameTracker {
+	return &renameTracker{names: make(map[string]string)}
+}
+
+// latest returns the latest path of the file found at p before the commits
+// given so far were made.
+func (rt *renameTracker) latest(p string) string {
+	if name, ok := rt.names[p]; ok {
+		return name
+	}
+	return p
+}
+
+// lineChanges is the number of lines added to and removed from a file.
+type lineChanges struct {
+	insertions int
+	deletions  int
+}
+
+// changes returns the lines changed by a commit, by latest path of the files
+// changed, and records the renames it made. Submodules are ignored.
+func (rt *renameTracker) changes(c model.Commit) map[string]lineChanges {
+	changes := make(map[string]lineChanges)
+	renames := make(map[string]string)
+	for _, d := range c.DiffDelta {
+		if d.Submodule != nil && *d.Submodule {
+			continue
+		}
+
+		var p *string
+		if d.Status != nil && *d.Status == model.StatusDeleted {
+			p = d.OldFilePath
+		} else {
+			p = d.NewFilePath
+		}
+		if p == nil {
+			continue
+		}
+
+		name := rt.latest(*p)
+		lc := changes[name]
+		if d.Insertions != nil {
+			lc.insertions += *d.Insertions
+		}
+		if d.Deletions != nil {
+			lc.deletions += *d.Deletions
+		}
+		changes[name] = lc
+
+		if d.Status != nil && *d.Status == model.StatusRenamed && d.OldFilePath != nil {
+			renames[*d.OldFilePath] = name
+		}
+	}
+
+	// before the commit, the new paths of renamed files did not exist, unless
+	// the files were swapped
+	for _, d := range c.DiffDelta {
+		if d.Status == nil || *d.Status != model.StatusRenamed || d.NewFilePath == nil {
+			continue
+		}
+		if _, ok := renames[*d.NewFilePath]; !ok {
+			delete(rt.names, *d.NewFilePath)
+		}
+	}
+	for old, name := range renames {
+		rt.names[old] = name
+	}
+
+	return changes
+}
+
+// files returns the latest paths of the files changed by a commit, sorted,
+// and records the renames it made. Submodules are ignored.
+func (rt *renameTracker) files(c model.Commit) []string {
+	changes := rt.changes(c)
+	files := make([]string, 0, len(changes))
+	for f := range changes {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// bySupport implements sort.Interface to sort couplings by decreasing
+// support, then by decreasing confidence, then by path.
+type bySupport []Coupling
+
+func (c bySupport) Len() int      { return len(c) }
+func (c bySupport) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c bySupport) Less(i, j int) bool {
+	switch {
+	case c[i].Commits != c[j].Commits:
+		return c[i].Commits > c[j].Commits
+	case c[i].Confidence != c[j].Confidence:
+		return c[i].Confidence > c[j].Confidence
+	case c[i].File != c[j].File:
+		return c[i].File < c[j].File
+	}
+	return c[i].CoupledFile < c[j].CoupledFile
+}
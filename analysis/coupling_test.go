@@ -0,0 +1,130 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DevMine/repotool/model"
+)
+
+// delta returns a delta of the given status changing a file from oldPath to
+// newPath, an empty path standing for no path.
+func delta(status, oldPath, newPath string, insertions, deletions int) model.DiffDelta {
+	d := model.DiffDelta{Status: &status, Insertions: &insertions, Deletions: &deletions}
+	if len(oldPath) > 0 {
+		d.OldFilePath = &oldPath
+	}
+	if len(newPath) > 0 {
+		d.NewFilePath = &newPath
+	}
+	return d
+}
+
+// modified returns a delta modifying the file at p.
+func modified(p string) model.DiffDelta {
+	return delta(model.StatusModified, p, p, 1, 1)
+}
+
+// date returns the time of the given day of January 2015.
+func date(day int) time.Time {
+	return time.Date(2015, time.January, day, 12, 0, 0, 0, time.UTC)
+}
+
+// couplingCommits returns commits in topological order, the dates of which
+// do not follow it, as when clocks are off.
+func couplingCommits() []model.Commit {
+	submodule := modified("lib")
+	isSubmodule := true
+	submodule.Submodule = &isSubmodule
+
+	return []model.Commit{
+		{CommitDate: date(1), DiffDelta: []model.DiffDelta{modified("a.go"), modified("b.go"), submodule}},
+		{CommitDate: date(20), DiffDelta: []model.DiffDelta{
+			modified("a.go"),
+			delta(model.StatusRenamed, "old.go", "b.go", 0, 0),
+		}},
+		{CommitDate: date(10), DiffDelta: []model.DiffDelta{modified("a.go"), modified("old.go"), modified("c.go")}},
+		{CommitDate: date(5), DiffDelta: []model.DiffDelta{
+			delta(model.StatusAdded, "", "a.go", 10, 0),
+			delta(model.StatusAdded, "", "old.go", 10, 0),
+			delta(model.StatusAdded, "", "c.go", 10, 0),
+		}},
+		{CommitDate: date(2), DiffDelta: []model.DiffDelta{
+			modified("d.go"), modified("e.go"), modified("f.go"), modified("g.go"),
+		}},
+	}
+}
+
+func TestChangeCoupling(t *testing.T) {
+	got := ChangeCoupling(couplingCommits(), 3, 2)
+	want := []Coupling{
+		{
+			File: "a.go", CoupledFile: "b.go", Commits: 4, FileCommits: 4, CoupledFileCommits: 4,
+			Support: 1, Confidence: 1, ReverseConfidence: 1,
+		},
+		{
+			File: "c.go", CoupledFile: "a.go", Commits: 2, FileCommits: 2, CoupledFileCommits: 4,
+			Support: 0.5, Confidence: 1, ReverseConfidence: 0.5,
+		},
+		{
+			File: "c.go", CoupledFile: "b.go", Commits: 2, FileCommits: 2, CoupledFileCommits: 4,
+			Support: 0.5, Confidence: 1, ReverseConfidence: 0.5,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestChangeCouplingLimits(t *testing.T) {
+	got := ChangeCoupling(couplingCommits(), 3, 3)
+	if len(got) != 1 || got[0].File != "a.go" || got[0].CoupledFile != "b.go" {
+		t.Errorf("minimum of 3 commits: got %+v", got)
+	}
+
+	// the commit changing 4 files counts, but its pairs fall below the
+	// minimum number of commits
+	got = ChangeCoupling(couplingCommits(), 0, 2)
+	if len(got) != 3 || got[0].Support != 0.8 {
+		t.Errorf("no maximum number of files: got %+v", got)
+	}
+
+	if got = ChangeCoupling(nil, 0, 0); got == nil || len(got) != 0 {
+		t.Errorf("no commits: got %#v, want an empty list", got)
+	}
+}
+
+func TestRenameTracker(t *testing.T) {
+	commits := []model.Commit{
+		{DiffDelta: []model.DiffDelta{modified("x"), modified("z")}},
+		// x and y are swapped
+		{DiffDelta: []model.DiffDelta{
+			delta(model.StatusRenamed, "x", "y", 0, 0),
+			delta(model.StatusRenamed, "y", "x", 0, 0),
+		}},
+		{DiffDelta: []model.DiffDelta{modified("x")}},
+		{DiffDelta: []model.DiffDelta{delta(model.StatusRenamed, "w", "z", 0, 0)}},
+		{DiffDelta: []model.DiffDelta{modified("w"), delta(model.StatusDeleted, "v", "", 0, 3)}},
+		{DiffDelta: []model.DiffDelta{delta(model.StatusAdded, "", "w", 3, 0), delta(model.StatusAdded, "", "v", 3, 0)}},
+	}
+	want := [][]string{
+		{"x", "z"},
+		{"x", "y"},
+		{"y"},
+		{"z"},
+		{"v", "z"},
+		{"v", "z"},
+	}
+
+	rt := newRenameTracker()
+	for i, c := range commits {
+		if got := rt.files(c); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("commit %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
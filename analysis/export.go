@@ -0,0 +1,108 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// couplingCSVHeader is the header of the CSV export of couplings.
+var couplingCSVHeader = []string{
+	"file",
+	"coupled_file",
+	"commits",
+	"file_commits",
+	"coupled_file_commits",
+	"support",
+	"confidence",
+	"reverse_confidence",
+}
+
+// WriteCouplingCSV writes couplings as CSV, one line per pair of files.
+func WriteCouplingCSV(w io.Writer, couplings []Coupling) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(couplingCSVHeader); err != nil {
+		return err
+	}
+
+	for _, c := range couplings {
+		err := cw.Write([]string{
+			c.File,
+			c.CoupledFile,
+			strconv.Itoa(c.Commits),
+			strconv.Itoa(c.FileCommits),
+			strconv.Itoa(c.CoupledFileCommits),
+			strconv.FormatFloat(c.Support, 'f', 4, 64),
+			strconv.FormatFloat(c.Confidence, 'f', 4, 64),
+			strconv.FormatFloat(c.ReverseConfidence, 'f', 4, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// statsCSVHeader is the header of the CSV export of stats.
+var statsCSVHeader = []string{
+	"window_days",
+	"kind",
+	"path",
+	"lines",
+	"commits",
+	"authors",
+	"insertions",
+	"deletions",
+	"churn_ratio",
+	"first_modified",
+	"last_modified",
+	"age_days",
+	"hotspot_score",
+}
+
+// WriteStatsCSV writes stats as CSV, one line per time window and file or
+// directory, the kind of path being "file" or "directory".
+func WriteStatsCSV(w io.Writer, s *Stats) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(statsCSVHeader); err != nil {
+		return err
+	}
+
+	for _, ws := range s.Windows {
+		for _, kind := range []struct {
+			name  string
+			stats []PathStats
+		}{{"file", ws.Files}, {"directory", ws.Directories}} {
+			for _, ps := range kind.stats {
+				err := cw.Write([]string{
+					strconv.Itoa(ws.Days),
+					kind.name,
+					ps.Path,
+					strconv.Itoa(ps.Lines),
+					strconv.Itoa(ps.Commits),
+					strconv.Itoa(ps.Authors),
+					strconv.Itoa(ps.Insertions),
+					strconv.Itoa(ps.Deletions),
+					strconv.FormatFloat(ps.ChurnRatio, 'f', 4, 64),
+					ps.FirstModified.Format(time.RFC3339),
+					ps.LastModified.Format(time.RFC3339),
+					strconv.Itoa(ps.AgeDays),
+					strconv.Itoa(ps.HotspotScore),
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,266 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DevMine/repotool/model"
+)
+
+// Stats represents metrics about the changes made to the files and
+// directories of a repository over time windows.
+type Stats struct {
+	// Date is the date the time windows end at: the date of the most recent
+	// commit.
+	Date time.Time `json:"date"`
+
+	// Windows is the list of the metrics computed for each time window.
+	Windows []WindowStats `json:"windows"`
+}
+
+// WindowStats represents metrics about the changes made to the files and
+// directories of a repository during a time window.
+type WindowStats struct {
+	// Days is the length of the time window, in days, or 0 for the whole
+	// history.
+	Days int `json:"days"`
+
+	// Since is the date the time window starts at, unless it is the whole
+	// history.
+	Since *time.Time `json:"since,omitempty"`
+
+	// Files is the list of the metrics of the files changed during the time
+	// window, the hottest spot first.
+	Files []PathStats `json:"files"`
+
+	// Directories is the list of the metrics of the directories whose files
+	// were changed during the time window, the hottest spot first. The root
+	// directory is ".".
+	Directories []PathStats `json:"directories"`
+}
+
+// PathStats represents metrics about the changes made to a file, or to the
+// files of a directory. Files are identified by their latest path, renames
+// being followed.
+type PathStats struct {
+	// Path is the path of the file or directory.
+	Path string `json:"path"`
+
+	// Lines is the number of lines of the file or directory in the tree HEAD
+	// points to. It is 0 for deleted files and binary files.
+	Lines int `json:"lines"`
+
+	// Commits is the number of commits which changed the file or directory.
+	Commits int `json:"commits"`
+
+	// Authors is the number of distinct authors of these commits.
+	Authors int `json:"authors"`
+
+	// Insertions is the number of lines added by these commits.
+	Insertions int `json:"insertions"`
+
+	// Deletions is the number of lines removed by these commits.
+	Deletions int `json:"deletions"`
+
+	// ChurnRatio is the number of lines added and removed by these commits
+	// relative to the number of lines of the file or directory, or 0 if it
+	// has none.
+	ChurnRatio float64 `json:"churn_ratio"`
+
+	// FirstModified is the date of the first commit which changed the file
+	// or directory, whatever the time window.
+	FirstModified time.Time `json:"first_modified"`
+
+	// LastModified is the date of the last commit which changed the file or
+	// directory, whatever the time window.
+	LastModified time.Time `json:"last_modified"`
+
+	// AgeDays is the number of days between FirstModified and the date the
+	// time windows end at.
+	AgeDays int `json:"age_days"`
+
+	// HotspotScore is the change frequency times the size of the file or
+	// directory: Commits times Lines.
+	HotspotScore int `json:"hotspot_score"`
+}
+
+// commitChanges represents the lines changed by a commit, by latest path of
+// the files changed.
+type commitChanges struct {
+	date    time.Time
+	author  string
+	changes map[string]lineChanges
+}
+
+// pathAccumulator accumulates the changes made to a file or directory.
+type pathAccumulator struct {
+	commits    int
+	authors    map[string]bool
+	insertions int
+	deletions  int
+}
+
+// ComputeStats computes metrics about the changes made to files and
+// directories by commits, which must come with their deltas and be in
+// topological order, every commit before its parents, as fetched by the repo
+// package, over time windows given in days, 0 standing for the whole
+// history. The number of lines of the files of the tree HEAD points to is
+// given by lines, by path.
+func ComputeStats(commits []model.Commit, lines map[string]int, windows []int) *Stats {
+	s := &Stats{Windows: make([]WindowStats, 0, len(windows))}
+	for _, c := range commits {
+		if c.CommitDate.After(s.Date) {
+			s.Date = c.CommitDate
+		}
+	}
+
+	tracker := newRenameTracker()
+	changes := make([]commitChanges, 0, len(commits))
+	for _, c := range commits {
+		author := c.Author.CanonicalEmail
+		if len(author) == 0 {
+			author = c.Author.Email
+		}
+		changes = append(changes, commitChanges{
+			date:    c.CommitDate,
+			author:  strings.ToLower(author),
+			changes: tracker.changes(c),
+		})
+	}
+
+	// lines of directories, and dates of the first and last changes, do not
+	// depend on the time window
+	dirLines := make(map[string]int)
+	for f, n := range lines {
+		for _, dir := range parentDirs(f) {
+			dirLines[dir] += n
+		}
+	}
+	first := make(map[string]time.Time)
+	last := make(map[string]time.Time)
+	for _, cc := range changes {
+		for f := range cc.changes {
+			for _, p := range append(parentDirs(f), f) {
+				if t, ok := first[p]; !ok || cc.date.Before(t) {
+					first[p] = cc.date
+				}
+				if t, ok := last[p]; !ok || cc.date.After(t) {
+					last[p] = cc.date
+				}
+			}
+		}
+	}
+
+	for _, days := range windows {
+		ws := WindowStats{Days: days}
+		var since time.Time
+		if days > 0 {
+			since = s.Date.AddDate(0, 0, -days)
+			ws.Since = &since
+		}
+
+		files := make(map[string]*pathAccumulator)
+		dirs := make(map[string]*pathAccumulator)
+		for _, cc := range changes {
+			if days > 0 && cc.date.Before(since) {
+				// commits are not sorted by date
+				continue
+			}
+
+			dirChanges := make(map[string]lineChanges)
+			for f, lc := range cc.changes {
+				accumulate(files, f, cc.author, lc)
+				for _, dir := range parentDirs(f) {
+					dlc := dirChanges[dir]
+					dlc.insertions += lc.insertions
+					dlc.deletions += lc.deletions
+					dirChanges[dir] = dlc
+				}
+			}
+			for dir, lc := range dirChanges {
+				accumulate(dirs, dir, cc.author, lc)
+			}
+		}
+
+		ws.Files = pathStats(files, lines, first, last, s.Date)
+		ws.Directories = pathStats(dirs, dirLines, first, last, s.Date)
+		s.Windows = append(s.Windows, ws)
+	}
+
+	return s
+}
+
+// accumulate adds the changes made by a commit to the path p to paths.
+func accumulate(paths map[string]*pathAccumulator, p, author string, lc lineChanges) {
+	acc, ok := paths[p]
+	if !ok {
+		acc = &pathAccumulator{authors: make(map[string]bool)}
+		paths[p] = acc
+	}
+	acc.commits++
+	acc.authors[author] = true
+	acc.insertions += lc.insertions
+	acc.deletions += lc.deletions
+}
+
+// pathStats converts accumulated changes to path metrics, sorted from the
+// hottest spot.
+func pathStats(paths map[string]*pathAccumulator, lines map[string]int, first, last map[string]time.Time, date time.Time) []PathStats {
+	stats := make([]PathStats, 0, len(paths))
+	for p, acc := range paths {
+		ps := PathStats{
+			Path:          p,
+			Lines:         lines[p],
+			Commits:       acc.commits,
+			Authors:       len(acc.authors),
+			Insertions:    acc.insertions,
+			Deletions:     acc.deletions,
+			FirstModified: first[p],
+			LastModified:  last[p],
+			AgeDays:       int(date.Sub(first[p]).Hours() / 24),
+			HotspotScore:  acc.commits * lines[p],
+		}
+		if ps.Lines > 0 {
+			ps.ChurnRatio = float64(ps.Insertions+ps.Deletions) / float64(ps.Lines)
+		}
+		stats = append(stats, ps)
+	}
+
+	sort.Sort(byHotspotScore(stats))
+	return stats
+}
+
+// parentDirs returns the directories a file belongs to, recursively, from
+// its directory to the root directory ".".
+func parentDirs(p string) []string {
+	var dirs []string
+	for dir := path.Dir(p); ; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == "." || dir == "/" {
+			return dirs
+		}
+	}
+}
+
+// byHotspotScore implements sort.Interface to sort path metrics by
+// decreasing hotspot score, then by decreasing number of commits, then by
+// path.
+type byHotspotScore []PathStats
+
+func (s byHotspotScore) Len() int      { return len(s) }
+func (s byHotspotScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byHotspotScore) Less(i, j int) bool {
+	switch {
+	case s[i].HotspotScore != s[j].HotspotScore:
+		return s[i].HotspotScore > s[j].HotspotScore
+	case s[i].Commits != s[j].Commits:
+		return s[i].Commits > s[j].Commits
+	}
+	return s[i].Path < s[j].Path
+}
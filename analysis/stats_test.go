@@ -0,0 +1,127 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DevMine/repotool/model"
+)
+
+func TestComputeStats(t *testing.T) {
+	jane := model.Developer{Email: "jane@example.org"}
+	john := model.Developer{Email: "john@example.org"}
+
+	// in topological order, the dates of which do not follow it
+	commits := []model.Commit{
+		{Author: jane, CommitDate: date(15), DiffDelta: []model.DiffDelta{modified("src/a.go")}},
+		{Author: john, CommitDate: date(25), DiffDelta: []model.DiffDelta{
+			delta(model.StatusRenamed, "src/old.go", "src/b.go", 2, 0),
+		}},
+		{
+			Author:     model.Developer{Email: "jane@laptop", CanonicalEmail: "Jane@Example.org"},
+			CommitDate: date(10),
+			DiffDelta:  []model.DiffDelta{modified("src/a.go"), modified("src/old.go")},
+		},
+		{Author: john, CommitDate: date(1), DiffDelta: []model.DiffDelta{
+			delta(model.StatusAdded, "", "src/a.go", 10, 0),
+			delta(model.StatusAdded, "", "src/old.go", 5, 0),
+			delta(model.StatusAdded, "", "README", 3, 0),
+		}},
+	}
+	lines := map[string]int{"src/a.go": 10, "src/b.go": 7, "README": 3}
+
+	since := date(18)
+	want := &Stats{
+		Date: date(25),
+		Windows: []WindowStats{
+			{
+				Days: 0,
+				Files: []PathStats{
+					{
+						Path: "src/a.go", Lines: 10, Commits: 3, Authors: 2, Insertions: 12, Deletions: 2,
+						ChurnRatio: 1.4, FirstModified: date(1), LastModified: date(15), AgeDays: 24, HotspotScore: 30,
+					},
+					{
+						Path: "src/b.go", Lines: 7, Commits: 3, Authors: 2, Insertions: 8, Deletions: 1,
+						ChurnRatio: float64(9) / 7, FirstModified: date(1), LastModified: date(25), AgeDays: 24, HotspotScore: 21,
+					},
+					{
+						Path: "README", Lines: 3, Commits: 1, Authors: 1, Insertions: 3,
+						ChurnRatio: 1, FirstModified: date(1), LastModified: date(1), AgeDays: 24, HotspotScore: 3,
+					},
+				},
+				Directories: []PathStats{
+					{
+						Path: ".", Lines: 20, Commits: 4, Authors: 2, Insertions: 23, Deletions: 3,
+						ChurnRatio: 1.3, FirstModified: date(1), LastModified: date(25), AgeDays: 24, HotspotScore: 80,
+					},
+					{
+						Path: "src", Lines: 17, Commits: 4, Authors: 2, Insertions: 20, Deletions: 3,
+						ChurnRatio: float64(23) / 17, FirstModified: date(1), LastModified: date(25), AgeDays: 24, HotspotScore: 68,
+					},
+				},
+			},
+			{
+				Days:  7,
+				Since: &since,
+				Files: []PathStats{
+					{
+						Path: "src/b.go", Lines: 7, Commits: 1, Authors: 1, Insertions: 2,
+						ChurnRatio: float64(2) / 7, FirstModified: date(1), LastModified: date(25), AgeDays: 24, HotspotScore: 7,
+					},
+				},
+				Directories: []PathStats{
+					{
+						Path: ".", Lines: 20, Commits: 1, Authors: 1, Insertions: 2,
+						ChurnRatio: 0.1, FirstModified: date(1), LastModified: date(25), AgeDays: 24, HotspotScore: 20,
+					},
+					{
+						Path: "src", Lines: 17, Commits: 1, Authors: 1, Insertions: 2,
+						ChurnRatio: float64(2) / 17, FirstModified: date(1), LastModified: date(25), AgeDays: 24, HotspotScore: 17,
+					},
+				},
+			},
+		},
+	}
+
+	got := ComputeStats(commits, lines, []int{0, 7})
+	if got.Date != want.Date {
+		t.Errorf("got date %v, want %v", got.Date, want.Date)
+	}
+	if len(got.Windows) != len(want.Windows) {
+		t.Fatalf("got %d windows, want %d", len(got.Windows), len(want.Windows))
+	}
+	for i, ws := range want.Windows {
+		if !reflect.DeepEqual(got.Windows[i], ws) {
+			t.Errorf("window of %d days: got %+v, want %+v", ws.Days, got.Windows[i], ws)
+		}
+	}
+}
+
+func TestComputeStatsNoCommits(t *testing.T) {
+	s := ComputeStats(nil, nil, []int{0})
+	if len(s.Windows) != 1 || len(s.Windows[0].Files) != 0 || len(s.Windows[0].Directories) != 0 {
+		t.Errorf("got %+v, want a single empty window", s)
+	}
+}
+
+func TestParentDirs(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"README", []string{"."}},
+		{"src/a.go", []string{"src", "."}},
+		{"a/b/c.go", []string{"a/b", "a", "."}},
+	}
+
+	for _, tt := range tests {
+		if got := parentDirs(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parentDirs(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
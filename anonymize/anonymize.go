@@ -0,0 +1,372 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package anonymize replaces the personal data found in repositories with
+// pseudonyms.
+//
+// Pseudonyms are computed with HMAC-SHA256, using a secret key, so that they
+// are stable: a given email or name always gets the same pseudonym, whatever
+// the repository it is found in, as long as the same key is used. Developers
+// can thus still be linked across repositories and datasets without their
+// identity being revealed.
+package anonymize
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/DevMine/repotool/model"
+)
+
+// Method is the anonymization method, as recorded in the repository
+// metadata.
+const Method = "hmac-sha256"
+
+const (
+	// pseudonymLen is the length, in hexadecimal characters, of the
+	// pseudonyms.
+	pseudonymLen = 16
+
+	// emailDomain is the domain of pseudonymous emails. The .invalid TLD
+	// is reserved so that they cannot be mistaken for real addresses.
+	emailDomain = "anonymized.invalid"
+
+	// minScrubbedNameLen is the minimum length of the names scrubbed from
+	// texts. Shorter names are too likely to be found in regular words.
+	minScrubbedNameLen = 3
+)
+
+// emailRe matches email addresses in texts.
+var emailRe = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+// identityRe matches identities given as "Name <email>", as found in the
+// values of trailers such as Signed-off-by or Co-authored-by.
+var identityRe = regexp.MustCompile(`^([^<>]*)<([^<>]*)>$`)
+
+// Anonymizer replaces the personal data of a repository with pseudonyms.
+// An Anonymizer is not safe for concurrent use.
+type Anonymizer struct {
+	key   []byte
+	scrub bool
+
+	// names of the developers anonymized so far, to scrub from texts
+	names map[string]bool
+}
+
+// New creates a new Anonymizer using the given secret key. If scrub is true,
+// emails and names of developers are also scrubbed from commit messages,
+// notes and patches, as well as from tag messages.
+func New(key string, scrub bool) *Anonymizer {
+	return &Anonymizer{key: []byte(key), scrub: scrub, names: make(map[string]bool)}
+}
+
+// Metadata returns the anonymization metadata to record in the repository.
+func (a *Anonymizer) Metadata() *model.Anonymization {
+	return &model.Anonymization{Method: Method, Scrubbed: a.scrub}
+}
+
+// Email returns the pseudonym of an email. Emails are not case sensitive.
+func (a *Anonymizer) Email(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if len(email) == 0 {
+		return email
+	}
+	return a.pseudonym("email:"+email) + "@" + emailDomain
+}
+
+// Name returns the pseudonym of a name.
+func (a *Anonymizer) Name(name string) string {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return name
+	}
+	return "developer-" + a.pseudonym("name:"+name)
+}
+
+// URL returns a remote URL stripped of user information, query and fragment,
+// and whose path components but the last one, usually the names of the users
+// or organizations owning the repository, are replaced with pseudonyms.
+// scp-like URLs (user@host:path) and local paths are handled as well. URLs
+// which cannot be parsed are dropped.
+func (a *Anonymizer) URL(rawurl string) string {
+	if strings.Contains(rawurl, "://") {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return ""
+		}
+		u.User = nil
+		u.Path = a.repositoryPath(u.Path)
+		u.RawPath = ""
+		u.RawQuery = ""
+		u.Fragment = ""
+		return u.String()
+	}
+
+	// scp-like URL, whose host cannot contain a slash
+	if i := strings.Index(rawurl, ":"); i > 0 && !strings.Contains(rawurl[:i], "/") {
+		host := rawurl[:i]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+		return host + ":" + a.repositoryPath(rawurl[i+1:])
+	}
+
+	return a.repositoryPath(rawurl)
+}
+
+// repositoryPath replaces the components of a repository path but the last
+// one with pseudonyms. Owners being case insensitive on most forges, so are
+// their pseudonyms.
+func (a *Anonymizer) repositoryPath(p string) string {
+	components := strings.Split(p, "/")
+	last := len(components) - 1
+	for last > 0 && len(components[last]) == 0 {
+		last--
+	}
+
+	for i, c := range components[:last] {
+		if len(c) == 0 || c == "." || c == ".." {
+			continue
+		}
+		components[i] = "owner-" + a.pseudonym("owner:"+strings.ToLower(c))
+	}
+	return strings.Join(components, "/")
+}
+
+// pseudonym returns the HMAC of s, in hexadecimal, truncated to
+// pseudonymLen characters.
+func (a *Anonymizer) pseudonym(s string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))[:pseudonymLen]
+}
+
+// Developer replaces the raw and canonical identities of a developer with
+// pseudonyms.
+func (a *Anonymizer) Developer(d *model.Developer) {
+	for _, name := range []string{d.Name, d.CanonicalName} {
+		if len(name) >= minScrubbedNameLen {
+			a.names[name] = true
+		}
+	}
+
+	d.Name = a.Name(d.Name)
+	d.Email = a.Email(d.Email)
+	d.CanonicalName = a.Name(d.CanonicalName)
+	d.CanonicalEmail = a.Email(d.CanonicalEmail)
+}
+
+// Repository replaces the personal data found in the clone URL and the
+// remote URLs of a repository, as done by URL.
+func (a *Anonymizer) Repository(r *model.Repository) {
+	r.CloneURL = a.URL(r.CloneURL)
+	for i := range r.Remotes {
+		r.Remotes[i].URL = a.URL(r.Remotes[i].URL)
+	}
+}
+
+// Commits anonymizes the developers of commits, the identities found in
+// their trailers and the owners of the repositories their issue references
+// point to and, if requested, scrubs texts. The key IDs of signatures are
+// replaced with pseudonyms and raw signatures are dropped, as they identify
+// their signer.
+func (a *Anonymizer) Commits(commits []model.Commit) {
+	// trailers holding an identity, which must not be scrubbed afterwards
+	identities := make(map[*model.Trailer]bool)
+
+	for i := range commits {
+		c := &commits[i]
+		a.Developer(&c.Author)
+		a.Developer(&c.Committer)
+		for j := range c.CoAuthors {
+			a.Developer(&c.CoAuthors[j])
+		}
+		for j := range c.Trailers {
+			if a.trailer(&c.Trailers[j]) {
+				identities[&c.Trailers[j]] = true
+			}
+		}
+		for j := range c.IssueRefs {
+			a.issueRef(&c.IssueRefs[j])
+		}
+		if c.Signature != nil {
+			if len(c.Signature.KeyID) > 0 {
+				c.Signature.KeyID = a.pseudonym("key:" + c.Signature.KeyID)
+			}
+			c.Signature.Raw = ""
+		}
+	}
+
+	if !a.scrub {
+		return
+	}
+
+	// names are only known once all developers have been anonymized
+	scrub := a.scrubber()
+	for i := range commits {
+		c := &commits[i]
+		c.Message = scrub(c.Message)
+		c.Subject = scrub(c.Subject)
+		c.Body = scrub(c.Body)
+		for j := range c.Trailers {
+			if !identities[&c.Trailers[j]] {
+				c.Trailers[j].Value = scrub(c.Trailers[j].Value)
+			}
+		}
+		for ref, note := range c.Notes {
+			c.Notes[ref] = scrub(note)
+		}
+		for j := range c.DiffDelta {
+			d := &c.DiffDelta[j]
+			if d.Patch != nil {
+				p := scrub(*d.Patch)
+				d.Patch = &p
+			}
+			for k := range d.DiffHunks {
+				h := &d.DiffHunks[k]
+				h.Header = scrub(h.Header)
+				for l := range h.Lines {
+					h.Lines[l].Content = scrub(h.Lines[l].Content)
+				}
+			}
+		}
+	}
+}
+
+// trailer replaces the identity held by the value of a trailer, given as
+// "Name <email>" or as a bare email, with its pseudonym, the same one as the
+// developer it belongs to gets. It returns false if the value holds no
+// identity.
+func (a *Anonymizer) trailer(t *model.Trailer) bool {
+	// "<email>" but not "<https://...>"
+	m := identityRe.FindStringSubmatch(t.Value)
+	if m != nil && strings.Contains(m[2], "@") && !strings.Contains(m[2], "/") {
+		d := model.Developer{Name: strings.TrimSpace(m[1]), Email: strings.TrimSpace(m[2])}
+		a.Developer(&d)
+		if len(d.Name) == 0 {
+			t.Value = "<" + d.Email + ">"
+		} else {
+			t.Value = d.Name + " <" + d.Email + ">"
+		}
+		return true
+	}
+
+	if email := strings.TrimSpace(t.Value); emailRe.FindString(email) == email && len(email) > 0 {
+		t.Value = a.Email(email)
+		return true
+	}
+	return false
+}
+
+// issueRef replaces the owner of the repository an issue reference points
+// to, if any, with its pseudonym, the same one as in remote URLs.
+func (a *Anonymizer) issueRef(ref *model.IssueRef) {
+	if len(ref.Repository) == 0 {
+		return
+	}
+
+	repository := a.repositoryPath(ref.Repository)
+	ref.Ref = strings.Replace(ref.Ref, ref.Repository, repository, 1)
+	ref.URL = strings.Replace(ref.URL, ref.Repository, repository, 1)
+	ref.Repository = repository
+}
+
+// Tags anonymizes the taggers of tags and, if requested, scrubs their
+// messages.
+func (a *Anonymizer) Tags(tags []model.Tag) {
+	for i := range tags {
+		if tags[i].Tagger != nil {
+			a.Developer(tags[i].Tagger)
+		}
+	}
+
+	if !a.scrub {
+		return
+	}
+
+	scrub := a.scrubber()
+	for i := range tags {
+		tags[i].Message = scrub(tags[i].Message)
+	}
+}
+
+// Ownership anonymizes the owners of files and directories.
+func (a *Anonymizer) Ownership(o *model.Ownership) {
+	for _, pos := range [][]model.PathOwnership{o.Files, o.Directories} {
+		for i := range pos {
+			for j := range pos[i].Owners {
+				a.Developer(&pos[i].Owners[j].Developer)
+			}
+		}
+	}
+}
+
+// scrubber returns a function replacing emails, and the names of the
+// developers anonymized so far, with their pseudonyms in texts.
+func (a *Anonymizer) scrubber() func(string) string {
+	var nameRe *regexp.Regexp
+	if len(a.names) > 0 {
+		names := make([]string, 0, len(a.names))
+		for name := range a.names {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+		// longest names first so that "John Doe" is preferred to "John"
+		sort.Sort(byLength(names))
+		nameRe = regexp.MustCompile(strings.Join(names, "|"))
+	}
+
+	return func(s string) string {
+		s = emailRe.ReplaceAllStringFunc(s, a.Email)
+		if nameRe == nil {
+			return s
+		}
+
+		var buf bytes.Buffer
+		var last int
+		for _, m := range nameRe.FindAllStringIndex(s, -1) {
+			// only replace whole words
+			if !isWordBoundary(s, m[0]) || !isWordBoundary(s, m[1]) {
+				continue
+			}
+			buf.WriteString(s[last:m[0]])
+			buf.WriteString(a.Name(s[m[0]:m[1]]))
+			last = m[1]
+		}
+		buf.WriteString(s[last:])
+		return buf.String()
+	}
+}
+
+// isWordBoundary returns true if the i-th byte of s is at a word boundary,
+// ie if it is not between two letters or digits. Unlike \b in regular
+// expressions, it handles non-ASCII letters.
+func isWordBoundary(s string, i int) bool {
+	before, _ := utf8.DecodeLastRuneInString(s[:i])
+	after, _ := utf8.DecodeRuneInString(s[i:])
+	return !isWordRune(before) || !isWordRune(after)
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// byLength implements sort.Interface to sort strings by decreasing length.
+type byLength []string
+
+func (s byLength) Len() int      { return len(s) }
+func (s byLength) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byLength) Less(i, j int) bool {
+	if len(s[i]) != len(s[j]) {
+		return len(s[i]) > len(s[j])
+	}
+	return s[i] < s[j]
+}
@@ -11,6 +11,7 @@ package main
 import (
 	"bytes"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -25,7 +26,10 @@ import (
 	"github.com/golang/glog"
 	"github.com/lib/pq"
 
+	"github.com/DevMine/repotool/analysis"
+	"github.com/DevMine/repotool/anonymize"
 	"github.com/DevMine/repotool/config"
+	"github.com/DevMine/repotool/identity"
 	"github.com/DevMine/repotool/model"
 	"github.com/DevMine/repotool/repo"
 )
@@ -40,7 +44,60 @@ var (
 		"is_file_binary",
 		"similarity",
 		"old_file_path",
-		"new_file_path"}
+		"new_file_path",
+		"insertions",
+		"deletions",
+		"hunks",
+		"diff_hunks",
+		"old_file_mode",
+		"new_file_mode",
+		"old_blob_id",
+		"new_blob_id",
+		"is_submodule",
+		"language",
+		"category"}
+
+	coAuthorFields = []string{
+		"commit_id",
+		"user_id",
+		"name",
+		"email"}
+
+	tagFields = []string{
+		"repository_id",
+		"tagger_id",
+		"name",
+		"target_vcs_id",
+		"is_annotated",
+		"message",
+		"tag_date",
+		"version",
+		"is_release",
+		"is_prerelease"}
+
+	noteFields = []string{
+		"commit_id",
+		"notes_ref",
+		"note"}
+
+	identityFields = []string{
+		"cluster_id",
+		"user_id",
+		"name",
+		"email",
+		"occurrences",
+		"confidence"}
+
+	couplingFields = []string{
+		"repository_id",
+		"file",
+		"coupled_file",
+		"commits",
+		"file_commits",
+		"coupled_file_commits",
+		"support",
+		"confidence",
+		"reverse_confidence"}
 
 	commitFields = []string{
 		"repository_id",
@@ -50,11 +107,27 @@ var (
 		"message",
 		"author_date",
 		"commit_date",
+		"author_tz_offset",
+		"committer_tz_offset",
+		"signature_type",
+		"signature_key_id",
+		"signature_status",
 		"file_changed_count",
 		"insertions_count",
 		"deletions_count"}
 )
 
+// commitChildFields maps the tables referencing the commits table, and filled
+// from commits data, to their fields.
+var commitChildFields = map[string][]string{
+	"commit_coauthors": coAuthorFields,
+	"commit_notes":     noteFields,
+}
+
+// commitIDsChunk is the number of commit IDs reserved at once when copying
+// commits into the database.
+const commitIDsChunk = 1000
+
 // program flags
 var (
 	configPath    = flag.String("c", "", "configuration file")
@@ -69,6 +142,14 @@ var (
 	commitsCount uint
 	userIDs      = map[string]uint64{}
 	repoIDs      = map[string]uint64{}
+
+	// identities collects the identities of developers when identity merging
+	// is enabled, nil otherwise
+	identities *identity.Merger
+
+	// coupling configures the change coupling analysis of repositories when
+	// it is stored, nil otherwise
+	coupling *config.CouplingConfig
 )
 
 type commit struct {
@@ -78,6 +159,12 @@ type commit struct {
 	model.Commit
 }
 
+// childRow is a row of a table referencing the commits table.
+type childRow struct {
+	table  string
+	values []interface{}
+}
+
 func main() {
 	var err error
 
@@ -142,13 +229,29 @@ func main() {
 		return
 	}
 
-	if err = fetchAllUsers(db); err != nil {
+	// developers emails and remote URLs are pseudonyms when anonymizing, so
+	// must be the emails of users and the clone URLs of repositories for
+	// them to be matched
+	var anonymizer *anonymize.Anonymizer
+	if len(cfg.Data.AnonymizationKey) > 0 {
+		anonymizer = anonymize.New(cfg.Data.AnonymizationKey, false)
+	}
+
+	if err = fetchAllUsers(db, anonymizer); err != nil {
 		return
 	}
-	if err = fetchAllRepos(db); err != nil {
+	if err = fetchAllRepos(db, anonymizer); err != nil {
 		return
 	}
 
+	if cfg.Identity.Merge {
+		identities = identity.NewMerger(cfg.Identity.NameThreshold, cfg.Identity.MergeThreshold)
+	}
+
+	if cfg.Coupling.Store {
+		coupling = &cfg.Coupling
+	}
+
 	var w sync.WaitGroup
 	var commitsChan chan commit
 	if !cfg.Data.CommitDeltas {
@@ -182,6 +285,10 @@ func main() {
 		close(commitsChan)
 		w.Wait()
 	}
+
+	if identities != nil {
+		err = storeIdentities(db, cfg.Identity)
+	}
 }
 
 func iterateRepos(reposPathChan chan string, path string, depth uint) {
@@ -227,25 +334,64 @@ func dbCopyRoutine(db *sql.DB, commitsChan chan commit) {
 		if err != nil {
 			return nil, nil, err
 		}
-		stmt, err := tx.Prepare(pq.CopyIn("commits", commitFields...))
+		// commit IDs are needed to fill the tables referencing commits,
+		// hence they are given explicitly
+		stmt, err := tx.Prepare(pq.CopyIn("commits", append([]string{"id"}, commitFields...)...))
 		if err != nil {
 			return nil, nil, err
 		}
 		return tx, stmt, nil
 	}
 
+	// rows of the tables referencing the commits of the current transaction
+	var children []childRow
+
 	commitTx := func(tx *sql.Tx, stmt *sql.Stmt) error {
 		defer tx.Rollback()
 		if err := stmt.Close(); err != nil {
 			return err
 		}
 
+		// only one copy may be in progress at once
+		for table, fields := range commitChildFields {
+			childStmt, err := tx.Prepare(pq.CopyIn(table, fields...))
+			if err != nil {
+				return err
+			}
+			for _, row := range children {
+				if row.table != table {
+					continue
+				}
+				if _, err := childStmt.Exec(row.values...); err != nil {
+					return err
+				}
+			}
+			if err := childStmt.Close(); err != nil {
+				return err
+			}
+		}
+		children = nil
+
 		if err := tx.Commit(); err != nil {
 			return err
 		}
 		return nil
 	}
 
+	var commitIDs []uint64
+	nextCommitID := func() (uint64, error) {
+		if len(commitIDs) == 0 {
+			ids, err := reserveIDs(db, "commits_id_seq", commitIDsChunk)
+			if err != nil {
+				return 0, err
+			}
+			commitIDs = ids
+		}
+		id := commitIDs[0]
+		commitIDs = commitIDs[1:]
+		return id, nil
+	}
+
 	dbExec := func(query string) {
 		if err == nil {
 			_, err = db.Exec(query)
@@ -253,15 +399,23 @@ func dbCopyRoutine(db *sql.DB, commitsChan chan commit) {
 	}
 	// disable constraints and indexes
 	dbExec("ALTER TABLE ONLY commit_diff_deltas DROP CONSTRAINT commit_diff_deltas_fk_commits")
+	dbExec("ALTER TABLE ONLY commit_coauthors DROP CONSTRAINT commit_coauthors_fk_commits")
+	dbExec("ALTER TABLE ONLY commit_notes DROP CONSTRAINT commit_notes_fk_commits")
 	dbExec("ALTER TABLE ONLY commits DROP CONSTRAINT commits_pk")
 	dbExec("ALTER TABLE ONLY commits DROP CONSTRAINT commits_fk_repositories")
 	dbExec("DROP INDEX fki_commit_diff_deltas_fk_commits")
+	dbExec("DROP INDEX fki_commit_coauthors_fk_commits")
+	dbExec("DROP INDEX fki_commit_notes_fk_commits")
 	dbExec("DROP INDEX fki_commits_fk_repositories")
 	defer func() {
 		dbExec("ALTER TABLE ONLY commits ADD CONSTRAINT commits_pk PRIMARY KEY (id)")
 		dbExec("ALTER TABLE ONLY commit_diff_deltas ADD CONSTRAINT commit_diff_deltas_fk_commits FOREIGN KEY (commit_id) REFERENCES commits(id)")
+		dbExec("ALTER TABLE ONLY commit_coauthors ADD CONSTRAINT commit_coauthors_fk_commits FOREIGN KEY (commit_id) REFERENCES commits(id)")
+		dbExec("ALTER TABLE ONLY commit_notes ADD CONSTRAINT commit_notes_fk_commits FOREIGN KEY (commit_id) REFERENCES commits(id)")
 		dbExec("ALTER TABLE ONLY commits ADD CONSTRAINT commits_fk_repositories FOREIGN KEY (repository_id) REFERENCES repositories(id)")
 		dbExec("CREATE INDEX fki_commit_diff_deltas_fk_commits ON commit_diff_deltas USING btree (commit_id)")
+		dbExec("CREATE INDEX fki_commit_coauthors_fk_commits ON commit_coauthors USING btree (commit_id)")
+		dbExec("CREATE INDEX fki_commit_notes_fk_commits ON commit_notes USING btree (commit_id)")
 		dbExec("CREATE INDEX fki_commits_fk_repositories ON commits USING btree (repository_id)")
 	}()
 
@@ -274,7 +428,15 @@ func dbCopyRoutine(db *sql.DB, commitsChan chan commit) {
 
 	var i uint
 	for c := range commitsChan {
+		var commitID uint64
+		if commitID, err = nextCommitID(); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		sigType, sigKeyID, sigStatus := signatureValues(c.Signature)
 		_, err = stmt.Exec(
+			commitID,
 			c.repoID,
 			c.authorID,
 			c.commiterID,
@@ -282,6 +444,11 @@ func dbCopyRoutine(db *sql.DB, commitsChan chan commit) {
 			c.Message,
 			c.AuthorDate,
 			c.CommitDate,
+			c.AuthorTZOffset,
+			c.CommitterTZOffset,
+			sigType,
+			sigKeyID,
+			sigStatus,
 			c.FileChangedCount,
 			c.InsertionsCount,
 			c.DeletionsCount)
@@ -289,6 +456,7 @@ func dbCopyRoutine(db *sql.DB, commitsChan chan commit) {
 			tx.Rollback()
 			return
 		}
+		children = append(children, commitChildRows(commitID, c.Commit)...)
 
 		i++
 
@@ -323,17 +491,28 @@ func repoRoutine(db *sql.DB, cfg config.DataConfig, commitsChan chan commit, rep
 				return err
 			}
 
+			if err = repository.FetchTags(); err != nil {
+				return err
+			}
+
+			if identities != nil {
+				collectIdentities(repository)
+			}
+
 			if cfg.CommitDeltas {
 				if err = insertRepoData(db, repository); err != nil {
 					return err
 				}
 			} else {
-				repoID, ok := repoIDs[repository.GetCloneURL()]
+				repoID, ok := lookupRepoID(repository)
 				if !ok {
 					return errors.New("cannot find corresponding repository in database")
 				}
+				if err = insertRepoTags(db, repoID, repository.GetTags()); err != nil {
+					return err
+				}
 				for _, c := range repository.GetCommits() {
-					commitsChan <- commit{repoID, userIDs[c.Author.Email], userIDs[c.Committer.Email], c}
+					commitsChan <- commit{repoID, lookupUserID(c.Author), lookupUserID(c.Committer), c}
 				}
 			}
 			return nil
@@ -344,6 +523,77 @@ func repoRoutine(db *sql.DB, cfg config.DataConfig, commitsChan chan commit, rep
 	}
 }
 
+// collectIdentities adds the identities of the developers of a repository to
+// the identities to merge.
+func collectIdentities(r repo.Repo) {
+	for _, c := range r.GetCommits() {
+		identities.AddDeveloper(c.Author)
+		identities.AddDeveloper(c.Committer)
+		for _, d := range c.CoAuthors {
+			identities.AddDeveloper(d)
+		}
+	}
+	for _, t := range r.GetTags() {
+		if t.Tagger != nil {
+			identities.AddDeveloper(*t.Tagger)
+		}
+	}
+}
+
+// storeIdentities merges the identities collected from all repositories and
+// replaces the content of the identities table with the resulting clusters.
+// Clusters are also exported for manual review if requested.
+func storeIdentities(db *sql.DB, cfg config.IdentityConfig) error {
+	glog.Info("merging developer identities...")
+	clusters := identities.Clusters()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM identities"); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("identities", identityFields...))
+	if err != nil {
+		return err
+	}
+	for _, c := range clusters {
+		for _, m := range c.Members {
+			d := model.Developer{Name: m.Name, Email: m.Email}
+			_, err := stmt.Exec(c.ID, lookupUserID(d), m.Name, m.Email, m.Occurrences, m.Confidence)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := stmt.Close(); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if len(cfg.ExportFile) == 0 {
+		return nil
+	}
+
+	f, err := os.Create(cfg.ExportFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := identity.WriteCSV(f, clusters); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
 // openDBSession creates a session to the database.
 func openDBSession(cfg config.DatabaseConfig) (*sql.DB, error) {
 	dbURL := fmt.Sprintf(
@@ -360,7 +610,7 @@ func insertRepoData(db *sql.DB, r repo.Repo) error {
 		return errors.New("nil database given")
 	}
 
-	repoID, ok := repoIDs[r.GetCloneURL()]
+	repoID, ok := lookupRepoID(r)
 	if !ok {
 		return errors.New("cannot find corresponding repository in database")
 	}
@@ -387,6 +637,17 @@ func insertRepoData(db *sql.DB, r repo.Repo) error {
 		}
 	}
 
+	if err := insertTags(repoID, r.GetTags(), tx); err != nil {
+		return err
+	}
+
+	if coupling != nil {
+		couplings := analysis.ChangeCoupling(r.GetCommits(), coupling.MaxFilesPerCommit, coupling.MinCommits)
+		if err := insertCouplings(repoID, couplings, tx); err != nil {
+			return err
+		}
+	}
+
 	if err := commitStmt.Close(); err != nil {
 		return err
 	}
@@ -400,15 +661,95 @@ func insertRepoData(db *sql.DB, r repo.Repo) error {
 	return nil
 }
 
+// insertRepoTags inserts the tags of a repository into the database, in a
+// transaction of their own.
+func insertRepoTags(db *sql.DB, repoID uint64, tags []model.Tag) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertTags(repoID, tags, tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertTags inserts the tags of a repository into the database
+func insertTags(repoID uint64, tags []model.Tag, tx *sql.Tx) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(genInsQuery("tags", tagFields...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range tags {
+		var taggerID *uint64
+		if t.Tagger != nil {
+			id := lookupUserID(*t.Tagger)
+			taggerID = &id
+		}
+
+		var version *string
+		if len(t.Version) > 0 {
+			version = &t.Version
+		}
+
+		_, err := stmt.Exec(
+			repoID, taggerID, t.Name, t.Target, t.Annotated, t.Message,
+			t.Date, version, t.Release, t.PreRelease)
+		if err != nil {
+			return err
+		}
+	}
+
+	return stmt.Close()
+}
+
+// insertCouplings inserts the change coupling of the files of a repository
+// into the database
+func insertCouplings(repoID uint64, couplings []analysis.Coupling, tx *sql.Tx) error {
+	if len(couplings) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(genInsQuery("file_coupling", couplingFields...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, c := range couplings {
+		_, err := stmt.Exec(
+			repoID, c.File, c.CoupledFile, c.Commits, c.FileCommits,
+			c.CoupledFileCommits, c.Support, c.Confidence, c.ReverseConfidence)
+		if err != nil {
+			return err
+		}
+	}
+
+	return stmt.Close()
+}
+
 // insertCommit inserts a commit into the database
 func insertCommit(repoID uint64, c model.Commit, tx *sql.Tx, commitStmt, deltaStmt *sql.Stmt) error {
-	authorID := userIDs[c.Author.Email]
-	committerID := userIDs[c.Committer.Email]
+	authorID := lookupUserID(c.Author)
+	committerID := lookupUserID(c.Committer)
+
+	sigType, sigKeyID, sigStatus := signatureValues(c.Signature)
 
 	var commitID uint64
 	err := commitStmt.QueryRow(
 		repoID, authorID, committerID,
 		c.VCSID, c.Message, c.AuthorDate, c.CommitDate,
+		c.AuthorTZOffset, c.CommitterTZOffset,
+		sigType, sigKeyID, sigStatus,
 		c.FileChangedCount, c.InsertionsCount, c.DeletionsCount).Scan(&commitID)
 	if err != nil {
 		return err
@@ -420,12 +761,69 @@ func insertCommit(repoID uint64, c model.Commit, tx *sql.Tx, commitStmt, deltaSt
 		}
 	}
 
+	for _, row := range commitChildRows(commitID, c) {
+		_, err := tx.Exec(genInsQuery(row.table, commitChildFields[row.table]...), row.values...)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// signatureValues returns the type, the key ID and the verification status
+// of a commit signature, as stored in the database. Values are nil when
+// unknown.
+func signatureValues(s *model.Signature) (sigType, keyID, status *string) {
+	if s == nil {
+		return nil, nil, nil
+	}
+
+	sigType = &s.Type
+	if len(s.KeyID) > 0 {
+		keyID = &s.KeyID
+	}
+	if len(s.Status) > 0 {
+		status = &s.Status
+	}
+	return
+}
+
+// commitChildRows returns the rows of the tables referencing the commits
+// table for the commit c, whose ID is commitID.
+func commitChildRows(commitID uint64, c model.Commit) []childRow {
+	var rows []childRow
+	for _, d := range c.CoAuthors {
+		rows = append(rows, childRow{
+			table:  "commit_coauthors",
+			values: []interface{}{commitID, lookupUserID(d), d.Name, d.Email},
+		})
+	}
+	for ref, note := range c.Notes {
+		rows = append(rows, childRow{
+			table:  "commit_notes",
+			values: []interface{}{commitID, ref, note},
+		})
+	}
+	return rows
+}
+
 // insertDiffDelta inserts a commit diff delta into the database.
 func insertDiffDelta(commitID uint64, d model.DiffDelta, stmt *sql.Stmt) error {
-	_, err := stmt.Exec(commitID, d.Status, d.Binary, d.Similarity, d.OldFilePath, d.NewFilePath)
+	var hunks *string
+	if d.DiffHunks != nil {
+		bs, err := json.Marshal(d.DiffHunks)
+		if err != nil {
+			return err
+		}
+		h := string(bs)
+		hunks = &h
+	}
+
+	_, err := stmt.Exec(commitID, d.Status, d.Binary, d.Similarity, d.OldFilePath, d.NewFilePath,
+		d.Insertions, d.Deletions, d.Hunks, hunks,
+		d.OldFileMode, d.NewFileMode, d.OldBlobID, d.NewBlobID, d.Submodule,
+		d.Language, d.Category)
 	if err != nil {
 		return err
 	}
@@ -433,8 +831,9 @@ func insertDiffDelta(commitID uint64, d model.DiffDelta, stmt *sql.Stmt) error {
 }
 
 // fetchAllUsers fetch users IDs and put them into the userIDs global hashmap
-// with their email address as keys.
-func fetchAllUsers(db *sql.DB) error {
+// with their email address as keys. If anonymizer is not nil, the pseudonyms
+// of email addresses are used as keys instead.
+func fetchAllUsers(db *sql.DB, anonymizer *anonymize.Anonymizer) error {
 	rows, err := db.Query("SELECT id, email FROM users WHERE email IS NOT NULL AND email != ''")
 	if err != nil {
 		return err
@@ -447,13 +846,29 @@ func fetchAllUsers(db *sql.DB) error {
 		if err := rows.Scan(&id, &email); err != nil {
 			return err
 		}
+		if anonymizer != nil {
+			email = anonymizer.Email(email)
+		}
 		userIDs[email] = id
 	}
 
 	return nil
 }
 
-func fetchAllRepos(db *sql.DB) error {
+// lookupUserID returns the ID of a developer in the database, looked up by
+// canonical email first, then by raw email. It returns 0 if the developer
+// cannot be found.
+func lookupUserID(d model.Developer) uint64 {
+	if id, ok := userIDs[d.CanonicalEmail]; ok {
+		return id
+	}
+	return userIDs[d.Email]
+}
+
+// fetchAllRepos fetch repositories IDs and put them into the repoIDs global
+// hashmap with their normalized clone URL as keys. If anonymizer is not nil,
+// the anonymized clone URLs are used instead.
+func fetchAllRepos(db *sql.DB, anonymizer *anonymize.Anonymizer) error {
 	rows, err := db.Query("SELECT id, clone_url FROM repositories")
 	if err != nil {
 		return err
@@ -466,12 +881,51 @@ func fetchAllRepos(db *sql.DB) error {
 		if err := rows.Scan(&id, &cloneURL); err != nil {
 			return err
 		}
-		repoIDs[cloneURL] = id
+		if anonymizer != nil {
+			cloneURL = anonymizer.URL(cloneURL)
+		}
+		repoIDs[repo.NormalizeURL(cloneURL)] = id
 	}
 
 	return nil
 }
 
+// lookupRepoID returns the database ID of a repository. The clone URL is
+// tried first, then the URLs of the other remotes of the repository.
+func lookupRepoID(r repo.Repo) (uint64, bool) {
+	if id, ok := repoIDs[repo.NormalizeURL(r.GetCloneURL())]; ok {
+		return id, true
+	}
+
+	for _, remote := range r.GetRemotes() {
+		if id, ok := repoIDs[repo.NormalizeURL(remote.URL)]; ok {
+			return id, true
+		}
+	}
+
+	return 0, false
+}
+
+// reserveIDs reserves n values of the sequence seqName and returns them.
+func reserveIDs(db *sql.DB, seqName string, n int) ([]uint64, error) {
+	rows, err := db.Query("SELECT nextval($1) FROM generate_series(1, $2)", seqName, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uint64, 0, n)
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
 // genInsQuery generates a query string for an insertion in the database.
 func genInsQuery(tableName string, fields ...string) string {
 	var buf bytes.Buffer
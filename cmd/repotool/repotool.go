@@ -15,12 +15,16 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime/pprof"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/DevMine/repotool/analysis"
 	"github.com/DevMine/repotool/config"
 	"github.com/DevMine/srcanlzr/src"
 
@@ -29,22 +33,81 @@ import (
 
 const version = "1.0.0"
 
+// modes of repotool, given before the repository path
+const (
+	// ownershipMode outputs the ownership of the files of the repository
+	// instead of its commits.
+	ownershipMode = "ownership"
+
+	// couplingMode outputs the change coupling of the files of the
+	// repository instead of its commits.
+	couplingMode = "coupling"
+
+	// historyMode outputs the commits which touched a file, given after
+	// the repository path, across renames and copies.
+	historyMode = "history"
+
+	// statsMode outputs churn and hotspot metrics about the files of the
+	// repository instead of its commits.
+	statsMode = "stats"
+)
+
+// modes maps the modes of repotool to their description.
+var modes = map[string]string{
+	ownershipMode: "output the ownership of the files of the repository",
+	couplingMode:  "output the pairs of files of the repository which change together",
+	historyMode:   "output the commits which touched the file given after the repository path",
+	statsMode:     "output churn and hotspot metrics about the files of the repository",
+}
+
 // program flags
 var (
-	versionflag       = flag.Bool("version", false, "print version.")
-	srctoolflag       = flag.String("srctool", "", "read json file produced by srctool (give stdin to read from stdin)")
-	cpuprofileflag    = flag.String("cpuprofile", "", "write cpu profile to file")
-	tmpDirflag        = flag.String("tmpdir", "", "temporary directory location")
-	fileSizeLimitflag = flag.Float64("filesizelimit", 0.1, "maximum size, in GB, for a file to be processed in the temporary directory location")
-	deltasflag        = flag.Bool("deltas", false, "fetch commit deltas")
-	patchesflag       = flag.Bool("patches", false, "fetch commit patches")
+	versionflag          = flag.Bool("version", false, "print version.")
+	srctoolflag          = flag.String("srctool", "", "read json file produced by srctool (give stdin to read from stdin)")
+	cpuprofileflag       = flag.String("cpuprofile", "", "write cpu profile to file")
+	tmpDirflag           = flag.String("tmpdir", "", "temporary directory location")
+	fileSizeLimitflag    = flag.Float64("filesizelimit", 0.1, "maximum size, in GB, for a file to be processed in the temporary directory location")
+	tarFileSizeflag      = flag.Float64("tarfilesizelimit", 2.0, "maximum size, in GB, of a single file extracted from a tar archive")
+	tarSizeflag          = flag.Float64("tarsizelimit", 10.0, "maximum size, in GB, of all files extracted from a tar archive")
+	tarObjectsflag       = flag.Bool("tarobjects", false, "read objects straight from tar archives instead of extracting them")
+	remoteflag           = flag.String("remote", "origin", "remote whose URL is used as clone URL")
+	deltasflag           = flag.Bool("deltas", false, "fetch commit deltas")
+	patchesflag          = flag.Bool("patches", false, "fetch commit patches (requires -deltas)")
+	hunksflag            = flag.Bool("hunks", false, "fetch commit patches as structured hunks (requires -deltas)")
+	lineageflag          = flag.Bool("lineage", false, "track files across renames and copies (requires -deltas)")
+	ignoreWSflag         = flag.Bool("ignorews", false, "ignore whitespace changes")
+	contextLinesflag     = flag.Uint("contextlines", 3, "number of context lines in patches")
+	maxPatchSizeflag     = flag.Int("maxpatchsize", 512*1024*1024, "size, in bytes, above which a file is considered as binary")
+	includeflag          = flag.String("include", "", "comma separated list of path patterns of files to take into account (eg src/,*.go)")
+	excludeflag          = flag.String("exclude", "", "comma separated list of path patterns of files to ignore (eg vendor/,*.min.js)")
+	renameThresholdflag  = flag.Uint("renamethreshold", 50, "similarity, in percent, above which a file is considered as renamed")
+	copyThresholdflag    = flag.Uint("copythreshold", 50, "similarity, in percent, above which a file is considered as copied")
+	renameLimitflag      = flag.Uint("renamelimit", 200, "maximum number of files to compare when detecting renames and copies")
+	copiesflag           = flag.Bool("copies", false, "detect copies among modified files")
+	copiesUnmodifiedflag = flag.Bool("copiesfromunmodified", false, "detect copies among all files, including unmodified ones")
+	gpgKeyringflag       = flag.String("gpgkeyring", "", "OpenPGP keyring used to verify GPG signatures of commits")
+	sshAllowedflag       = flag.String("sshallowedsigners", "", "SSH allowed signers file used to verify SSH signatures of commits")
+	notesflag            = flag.String("notes", "", "comma separated list of notes references to read commit notes from (eg commits,review)")
+	mailmapflag          = flag.String("mailmap", "", "mailmap file applied on top of the .mailmap of the repository")
+	ignoreRevsflag       = flag.String("ignorerevs", "", "file listing commits to skip over when computing ownership (eg .git-blame-ignore-revs)")
+	couplingMaxFilesflag = flag.Int("couplingmaxfiles", 30, "number of files changed by a commit above which it is left out of change coupling (0 for no limit)")
+	couplingMinflag      = flag.Int("couplingmincommits", 2, "minimum number of commits changing two files for their coupling to be output")
+	windowsflag          = flag.String("windows", "0,90,365", "comma separated list of time windows, in days, of the stats mode (0 for the whole history)")
+	formatflag           = flag.String("format", "json", "output format of the coupling and stats modes (json or csv)")
+	anonKeyflag          = flag.String("anonkey", "", "secret key used to replace names and emails of developers with pseudonyms")
+	scrubflag            = flag.Bool("scrub", false, "scrub names and emails of developers from messages, notes and patches (requires -anonkey)")
 )
 
 func main() {
 	var err error
 
 	flag.Usage = func() {
-		fmt.Printf("usage: %s [OPTION(S)] [REPOSITORY PATH]\n", os.Args[0])
+		fmt.Printf("usage: %s [OPTION(S)] [MODE] [REPOSITORY PATH] [FILE PATH]\n", os.Args[0])
+		fmt.Println("\nmodes:")
+		for _, m := range []string{ownershipMode, couplingMode, historyMode, statsMode} {
+			fmt.Printf("  %s\t%s\n", m, modes[m])
+		}
+		fmt.Println("\noptions:")
 		flag.PrintDefaults()
 		os.Exit(0)
 	}
@@ -64,7 +127,15 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	if len(flag.Args()) != 1 {
+	var mode, filePath string
+	args := flag.Args()
+	if len(args) > 1 && len(modes[args[0]]) > 0 {
+		mode, args = args[0], args[1:]
+	}
+	if mode == historyMode && len(args) == 2 {
+		filePath, args = path.Clean(filepath.ToSlash(args[1])), args[:1]
+	}
+	if len(args) != 1 || (mode == historyMode && len(filePath) == 0) {
 		fmt.Fprintln(os.Stderr, "invalid # of arguments")
 		flag.Usage()
 	}
@@ -72,10 +143,66 @@ func main() {
 	cfg := new(config.Config)
 	cfg.Data.TmpDir = *tmpDirflag
 	cfg.Data.TmpDirFileSizeLimit = *fileSizeLimitflag
+	cfg.Data.TarFileSizeLimit = *tarFileSizeflag
+	cfg.Data.TarSizeLimit = *tarSizeflag
+	cfg.Data.TarObjects = *tarObjectsflag
+	cfg.Data.Remote = *remoteflag
 	cfg.Data.CommitDeltas = *deltasflag
 	cfg.Data.CommitPatches = *patchesflag
+	cfg.Data.CommitHunks = *hunksflag
+	cfg.Data.FileLineage = *lineageflag
+	cfg.Data.IgnoreWhitespace = *ignoreWSflag
+	cfg.Data.ContextLines = contextLinesflag
+	cfg.Data.MaxPatchSize = *maxPatchSizeflag
+	cfg.Data.IncludePaths = splitList(*includeflag)
+	cfg.Data.ExcludePaths = splitList(*excludeflag)
+	cfg.Data.RenameThreshold = thresholdFlag(*renameThresholdflag)
+	cfg.Data.CopyThreshold = thresholdFlag(*copyThresholdflag)
+	cfg.Data.RenameLimit = *renameLimitflag
+	cfg.Data.FindCopies = *copiesflag
+	cfg.Data.FindCopiesFromUnmodified = *copiesUnmodifiedflag
+	cfg.Data.GPGKeyring = *gpgKeyringflag
+	cfg.Data.SSHAllowedSigners = *sshAllowedflag
+	cfg.Data.NotesRefs = splitList(*notesflag)
+	cfg.Data.MailmapFile = *mailmapflag
+	cfg.Data.IgnoreRevsFile = *ignoreRevsflag
+	cfg.Data.AnonymizationKey = *anonKeyflag
+	cfg.Data.ScrubPersonalData = *scrubflag
+	cfg.Coupling.MaxFilesPerCommit = *couplingMaxFilesflag
+	cfg.Coupling.MinCommits = *couplingMinflag
 
-	repoPath := flag.Arg(0)
+	if *formatflag != "json" && *formatflag != "csv" {
+		fatal("invalid output format:", *formatflag)
+	}
+
+	var windows []int
+	for _, w := range splitList(*windowsflag) {
+		days, err := strconv.Atoi(w)
+		if err != nil || days < 0 {
+			fatal("invalid time window:", w)
+		}
+		windows = append(windows, days)
+	}
+
+	switch mode {
+	case couplingMode, statsMode:
+		// files changed by commits are only known along with deltas
+		cfg.Data.CommitDeltas = true
+	case historyMode:
+		cfg.Data.CommitDeltas = true
+		cfg.Data.FileLineage = true
+	}
+
+	// the configuration built from flags is checked as a configuration file
+	// would be
+	if err := cfg.Data.Verify(); err != nil {
+		fatal(err)
+	}
+	if err := cfg.Coupling.Verify(); err != nil {
+		fatal(err)
+	}
+
+	repoPath := args[0]
 	var repository repo.Repo
 	repository, err = repo.New(cfg.Data, repoPath)
 	if err != nil {
@@ -88,15 +215,91 @@ func main() {
 		}
 	}()
 
+	if mode == ownershipMode {
+		fmt.Fprintln(os.Stderr, "computing files ownership...")
+		tic := time.Now()
+		err = repository.FetchOwnership()
+		if err != nil {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "done in ", time.Now().Sub(tic))
+
+		var bs []byte
+		bs, err = json.Marshal(repository.GetOwnership())
+		if err != nil {
+			return
+		}
+		fmt.Println(string(bs))
+		return
+	}
+
 	fmt.Fprintln(os.Stderr, "fetching repository commits...")
 	tic := time.Now()
 	err = repository.FetchCommits()
 	if err != nil {
 		return
 	}
+	err = repository.FetchTags()
+	if err != nil {
+		return
+	}
 	toc := time.Now()
 	fmt.Fprintln(os.Stderr, "done in ", toc.Sub(tic))
 
+	if mode == historyMode {
+		h := repository.GetFileHistory(filePath)
+		if len(h.Files) == 0 {
+			err = fmt.Errorf("%s: no such file in the history of the repository", filePath)
+			return
+		}
+
+		var bs []byte
+		bs, err = json.Marshal(h)
+		if err != nil {
+			return
+		}
+		fmt.Println(string(bs))
+		return
+	}
+
+	if mode == statsMode {
+		var lines map[string]int
+		lines, err = repository.CountLines()
+		if err != nil {
+			return
+		}
+
+		stats := analysis.ComputeStats(repository.GetCommits(), lines, windows)
+		if *formatflag == "csv" {
+			err = analysis.WriteStatsCSV(os.Stdout, stats)
+			return
+		}
+
+		var bs []byte
+		bs, err = json.Marshal(stats)
+		if err != nil {
+			return
+		}
+		fmt.Println(string(bs))
+		return
+	}
+
+	if mode == couplingMode {
+		couplings := analysis.ChangeCoupling(repository.GetCommits(), cfg.Coupling.MaxFilesPerCommit, cfg.Coupling.MinCommits)
+		if *formatflag == "csv" {
+			err = analysis.WriteCouplingCSV(os.Stdout, couplings)
+			return
+		}
+
+		var bs []byte
+		bs, err = json.Marshal(couplings)
+		if err != nil {
+			return
+		}
+		fmt.Println(string(bs))
+		return
+	}
+
 	if *srctoolflag == "" {
 		var bs []byte
 		bs, err = json.Marshal(repository)
@@ -136,6 +339,27 @@ func main() {
 	}
 }
 
+// splitList splits a comma separated list, ignoring empty elements.
+func splitList(list string) []string {
+	var elems []string
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); len(e) > 0 {
+			elems = append(elems, e)
+		}
+	}
+	return elems
+}
+
+// thresholdFlag converts a similarity threshold flag to the 16 bits the
+// threshold is stored on. Values which do not fit are saturated so that the
+// configuration checks still reject them.
+func thresholdFlag(v uint) uint16 {
+	if v > math.MaxUint16 {
+		return math.MaxUint16
+	}
+	return uint16(v)
+}
+
 // fatal prints an error on standard error stream and exits.
 func fatal(a ...interface{}) {
 	fmt.Fprintln(os.Stderr, a...)
@@ -8,7 +8,9 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"path"
 	"strings"
 )
 
@@ -26,6 +28,8 @@ var sslModes = map[string]bool{
 type Config struct {
 	Database *DatabaseConfig `json:"database"`
 	Data     DataConfig      `json:"data"`
+	Identity IdentityConfig  `json:"identity"`
+	Coupling CouplingConfig  `json:"coupling"`
 }
 
 // DatabaseConfig is a configuration for PostgreSQL database connection
@@ -58,8 +62,165 @@ type DataConfig struct {
 	// larger than this value will not be processed in TmpDir.
 	TmpDirFileSizeLimit float64 `json:"tmp_dir_file_size_limit"`
 
+	// TarFileSizeLimit is the maximum size in GB of a single file extracted
+	// from a tar archive. Archives containing a larger file are rejected.
+	// Defaults to 2.
+	TarFileSizeLimit float64 `json:"tar_file_size_limit"`
+
+	// TarSizeLimit is the maximum size in GB of all the files extracted from
+	// a tar archive. Archives whose extracted content would be larger are
+	// rejected. Defaults to 10.
+	TarSizeLimit float64 `json:"tar_size_limit"`
+
+	// TarObjects makes objects be read straight from tar archives instead
+	// of being extracted: only the other files of the git directory, which
+	// are small, are extracted. Objects larger than TarFileSizeLimit are
+	// rejected.
+	TarObjects bool `json:"tar_objects"`
+
+	// Remote is the name of the remote whose URL is used as the repository
+	// clone URL. If the repository has no such remote, the first remote is
+	// used. Defaults to "origin".
+	Remote string `json:"remote"`
+
 	CommitDeltas  bool `json:"commit_deltas"`
 	CommitPatches bool `json:"commit_patches"`
+
+	// CommitHunks enables a structured representation of patches: hunks
+	// with their lines.
+	CommitHunks bool `json:"commit_hunks"`
+
+	// FileLineage enables the tracking of files across renames and copies,
+	// each file being given a stable ID along with the list of its paths and
+	// changes.
+	FileLineage bool `json:"file_lineage"`
+
+	// IgnoreWhitespace tells whether whitespace changes shall be ignored when
+	// computing the changes made by commits.
+	IgnoreWhitespace bool `json:"ignore_whitespace"`
+
+	// ContextLines is the number of unchanged lines surrounding changes in
+	// patches and hunks. Defaults to 3.
+	ContextLines *uint `json:"context_lines"`
+
+	// MaxPatchSize is the size, in bytes, above which a file is considered
+	// as binary: no patch is produced and no line change counted for it.
+	// Defaults to 512 MB.
+	MaxPatchSize int `json:"max_patch_size"`
+
+	// IncludePaths is a list of patterns restricting the files taken into
+	// account when computing the changes made by commits (both for deltas
+	// and line and file counts). A pattern ending with a slash matches a
+	// directory, a pattern without a slash matches file names and a leading
+	// slash anchors a pattern to the repository root (eg "src/", "*.go").
+	// All files are taken into account if left empty.
+	IncludePaths []string `json:"include_paths"`
+
+	// ExcludePaths is a list of patterns, using the same syntax as
+	// IncludePaths, of files to ignore when computing the changes made by
+	// commits (eg "vendor/", "*.min.js").
+	ExcludePaths []string `json:"exclude_paths"`
+
+	// RenameThreshold is the similarity, in percent, above which a deleted
+	// file and an added file are considered as a renamed file.
+	// Defaults to 50.
+	RenameThreshold uint16 `json:"rename_threshold"`
+
+	// CopyThreshold is the similarity, in percent, above which an added file
+	// is considered as a copy of another file. Defaults to 50.
+	CopyThreshold uint16 `json:"copy_threshold"`
+
+	// RenameLimit is the maximum number of files to compare with each other
+	// when detecting renames and copies. Defaults to 200.
+	RenameLimit uint `json:"rename_limit"`
+
+	// FindCopies enables the detection of copies among files modified by a
+	// commit.
+	FindCopies bool `json:"find_copies"`
+
+	// FindCopiesFromUnmodified enables the detection of copies among all the
+	// files of a commit, including unmodified ones. This is expensive for
+	// large repositories.
+	FindCopiesFromUnmodified bool `json:"find_copies_from_unmodified"`
+
+	// GPGKeyring is the path to an OpenPGP keyring, armored or not, used to
+	// verify the GPG signatures of commits. GPG signatures are not verified
+	// if left empty.
+	GPGKeyring string `json:"gpg_keyring"`
+
+	// SSHAllowedSigners is the path to an SSH allowed signers file, as used
+	// by git (gpg.ssh.allowedSignersFile), used to verify the SSH signatures
+	// of commits. SSH signatures are not verified if left empty.
+	SSHAllowedSigners string `json:"ssh_allowed_signers"`
+
+	// NotesRefs is the list of notes references (eg "refs/notes/commits",
+	// "refs/notes/review") from which the notes of commits are read. As
+	// with git, names not starting with "refs/notes/" are looked up under
+	// this prefix. Notes are not read if left empty.
+	NotesRefs []string `json:"notes_refs"`
+
+	// MailmapFile is the path to a mailmap file applied to all repositories,
+	// on top of their own .mailmap, to find the canonical identity of
+	// developers.
+	MailmapFile string `json:"mailmap_file"`
+
+	// IgnoreRevsFile is the path to a file listing the IDs of commits, one
+	// per line, to skip over when computing the ownership of files, in the
+	// format of git blame --ignore-revs-file. Relative paths are looked up
+	// in the tree HEAD points to (eg ".git-blame-ignore-revs").
+	IgnoreRevsFile string `json:"ignore_revs_file"`
+
+	// AnonymizationKey is the secret key used to replace the names and
+	// emails of developers with stable pseudonyms. Use the same key for all
+	// repositories for pseudonyms to be consistent across them. Personal
+	// data are not anonymized if left empty.
+	AnonymizationKey string `json:"anonymization_key"`
+
+	// ScrubPersonalData enables, along with anonymization, the replacement
+	// of emails and names of developers found in commit messages, notes,
+	// patches and tag messages with their pseudonyms.
+	ScrubPersonalData bool `json:"scrub_personal_data"`
+}
+
+// IdentityConfig is used to configure the merging of developer identities
+// across repositories by repotool-db.
+type IdentityConfig struct {
+	// Merge enables the merging of the identities of the developers found in
+	// all processed repositories. The resulting clusters of identities are
+	// stored in the identities table.
+	Merge bool `json:"merge"`
+
+	// NameThreshold is the minimum similarity, between 0 and 1, of the
+	// normalized names of two identities for them to be linked on the basis
+	// of their names. Defaults to 0.9.
+	NameThreshold float64 `json:"name_threshold"`
+
+	// MergeThreshold is the minimum confidence, between 0 and 1, that two
+	// identities belong to the same developer for them to be merged.
+	// Defaults to 0.85.
+	MergeThreshold float64 `json:"merge_threshold"`
+
+	// ExportFile is the path to a CSV file to which clusters of identities
+	// are exported for manual review. No export is made if left empty.
+	ExportFile string `json:"export_file"`
+}
+
+// CouplingConfig is used to configure the change coupling analysis, ie which
+// files change together, performed by repotool-db.
+type CouplingConfig struct {
+	// Store enables the change coupling analysis of repositories, whose
+	// results are stored in the file_coupling table. It requires commit
+	// deltas.
+	Store bool `json:"store"`
+
+	// MaxFilesPerCommit is the number of files changed by a commit above
+	// which the commit is left out of the analysis, as mass changes do not
+	// tell anything about the coupling of files. Defaults to 30.
+	MaxFilesPerCommit int `json:"max_files_per_commit"`
+
+	// MinCommits is the minimum number of commits changing two files for
+	// their coupling to be stored. Defaults to 2.
+	MinCommits int `json:"min_commits"`
 }
 
 // ReadConfig reads a JSON formatted configuration file, verifies the values
@@ -84,6 +245,34 @@ func ReadConfig(path string) (*Config, error) {
 		cfg.Data.TmpDirFileSizeLimit = 0.01
 	}
 
+	if cfg.Data.TarFileSizeLimit == 0 {
+		cfg.Data.TarFileSizeLimit = 2.0
+	}
+
+	if cfg.Data.TarSizeLimit == 0 {
+		cfg.Data.TarSizeLimit = 10.0
+	}
+
+	if len(cfg.Data.Remote) == 0 {
+		cfg.Data.Remote = "origin"
+	}
+
+	if cfg.Identity.NameThreshold == 0 {
+		cfg.Identity.NameThreshold = 0.9
+	}
+
+	if cfg.Identity.MergeThreshold == 0 {
+		cfg.Identity.MergeThreshold = 0.85
+	}
+
+	if cfg.Coupling.MaxFilesPerCommit == 0 {
+		cfg.Coupling.MaxFilesPerCommit = 30
+	}
+
+	if cfg.Coupling.MinCommits == 0 {
+		cfg.Coupling.MinCommits = 2
+	}
+
 	if cfg.Database.CommitsPerTransaction == 0 {
 		cfg.Database.CommitsPerTransaction = 1000000
 	}
@@ -107,6 +296,20 @@ func (c Config) verify() error {
 		return err
 	}
 
+	err = c.Identity.verify()
+	if err != nil {
+		return err
+	}
+
+	if c.Coupling.Store && !c.Data.CommitDeltas {
+		return errors.New("change coupling may only be stored along with commit deltas")
+	}
+
+	err = c.Coupling.verify()
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -138,10 +341,88 @@ func (dc DatabaseConfig) verify() error {
 	return nil
 }
 
+// Verify checks a data configuration which was not read by ReadConfig, such
+// as one built from command line flags.
+func (dc DataConfig) Verify() error {
+	return dc.verify()
+}
+
 func (dc DataConfig) verify() error {
 	if dc.CommitPatches && !dc.CommitDeltas {
 		return errors.New("commit patches may only be specified along with commit deltas")
 	}
 
+	if dc.CommitHunks && !dc.CommitDeltas {
+		return errors.New("commit hunks may only be specified along with commit deltas")
+	}
+
+	if dc.FileLineage && !dc.CommitDeltas {
+		return errors.New("file lineage may only be specified along with commit deltas")
+	}
+
+	if dc.RenameThreshold > 100 || dc.CopyThreshold > 100 {
+		return errors.New("rename and copy thresholds cannot be greater than 100")
+	}
+
+	if dc.MaxPatchSize < 0 {
+		return errors.New("max patch size cannot be negative")
+	}
+
+	for _, patterns := range [][]string{dc.IncludePaths, dc.ExcludePaths} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid path pattern %q: %v", pattern, err)
+			}
+		}
+	}
+
+	for _, ref := range dc.NotesRefs {
+		if len(strings.TrimSpace(ref)) == 0 {
+			return errors.New("notes references cannot be empty")
+		}
+	}
+
+	if dc.ScrubPersonalData && len(dc.AnonymizationKey) == 0 {
+		return errors.New("personal data may only be scrubbed along with anonymization")
+	}
+
+	if dc.TarFileSizeLimit < 0 || dc.TarSizeLimit < 0 {
+		return errors.New("tar size limits cannot be negative")
+	}
+
+	return nil
+}
+
+func (ic IdentityConfig) verify() error {
+	if ic.NameThreshold < 0 || ic.NameThreshold > 1 {
+		return errors.New("identity name threshold must be between 0 and 1")
+	}
+
+	if ic.MergeThreshold < 0 || ic.MergeThreshold > 1 {
+		return errors.New("identity merge threshold must be between 0 and 1")
+	}
+
+	if len(ic.ExportFile) > 0 && !ic.Merge {
+		return errors.New("identities may only be exported along with identity merging")
+	}
+
+	return nil
+}
+
+// Verify checks a change coupling configuration which was not read by
+// ReadConfig, such as one built from command line flags.
+func (cc CouplingConfig) Verify() error {
+	return cc.verify()
+}
+
+func (cc CouplingConfig) verify() error {
+	if cc.MaxFilesPerCommit < 0 {
+		return errors.New("coupling max files per commit cannot be negative")
+	}
+
+	if cc.MinCommits < 0 {
+		return errors.New("coupling min commits cannot be negative")
+	}
+
 	return nil
 }
@@ -0,0 +1,54 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import "testing"
+
+func TestDataConfigVerify(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   DataConfig
+		valid bool
+	}{
+		{"empty", DataConfig{}, true},
+		{"deltas and patches", DataConfig{CommitDeltas: true, CommitPatches: true, CommitHunks: true}, true},
+		{"patches without deltas", DataConfig{CommitPatches: true}, false},
+		{"hunks without deltas", DataConfig{CommitHunks: true}, false},
+		{"lineage without deltas", DataConfig{FileLineage: true}, false},
+		{"rename threshold of 100", DataConfig{RenameThreshold: 100, CopyThreshold: 100}, true},
+		{"rename threshold above 100", DataConfig{RenameThreshold: 101}, false},
+		{"copy threshold above 100", DataConfig{CopyThreshold: 200}, false},
+		{"negative max patch size", DataConfig{MaxPatchSize: -1}, false},
+		{"invalid path pattern", DataConfig{ExcludePaths: []string{"[a-"}}, false},
+		{"empty notes reference", DataConfig{NotesRefs: []string{" "}}, false},
+		{"scrub without key", DataConfig{ScrubPersonalData: true}, false},
+		{"scrub with key", DataConfig{ScrubPersonalData: true, AnonymizationKey: "secret"}, true},
+		{"negative tar size limit", DataConfig{TarSizeLimit: -1}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Verify(); (err == nil) != tt.valid {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
+
+func TestCouplingConfigVerify(t *testing.T) {
+	tests := []struct {
+		cfg   CouplingConfig
+		valid bool
+	}{
+		{CouplingConfig{}, true},
+		{CouplingConfig{MaxFilesPerCommit: 30, MinCommits: 2}, true},
+		{CouplingConfig{MaxFilesPerCommit: -1}, false},
+		{CouplingConfig{MinCommits: -1}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Verify(); (err == nil) != tt.valid {
+			t.Errorf("%+v: got %v", tt.cfg, err)
+		}
+	}
+}
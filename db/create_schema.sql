@@ -13,6 +13,38 @@ SET search_path = public, pg_catalog;
 
 SET default_with_oids = false;
 
+--
+-- Name: commit_coauthors; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE commit_coauthors (
+    id bigint NOT NULL,
+    commit_id bigint NOT NULL,
+    user_id bigint,
+    name character varying NOT NULL,
+    email character varying NOT NULL
+);
+
+
+--
+-- Name: commit_coauthors_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE commit_coauthors_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: commit_coauthors_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE commit_coauthors_id_seq OWNED BY commit_coauthors.id;
+
+
 --
 -- Name: commit_diff_deltas; Type: TABLE; Schema: public; Owner: -
 --
@@ -24,7 +56,18 @@ CREATE TABLE commit_diff_deltas (
     is_file_binary boolean,
     similarity integer,
     old_file_path character varying NOT NULL,
-    new_file_path character varying NOT NULL
+    new_file_path character varying NOT NULL,
+    insertions integer,
+    deletions integer,
+    hunks integer,
+    diff_hunks json,
+    old_file_mode character varying,
+    new_file_mode character varying,
+    old_blob_id character varying,
+    new_blob_id character varying,
+    is_submodule boolean,
+    language character varying,
+    category character varying
 );
 
 
@@ -60,6 +103,11 @@ CREATE TABLE commits (
     message text,
     author_date timestamp with time zone,
     commit_date timestamp with time zone,
+    author_tz_offset integer,
+    committer_tz_offset integer,
+    signature_type character varying,
+    signature_key_id character varying,
+    signature_status character varying,
     file_changed_count integer,
     insertions_count integer,
     deletions_count integer
@@ -85,6 +133,153 @@ CREATE SEQUENCE commits_id_seq
 ALTER SEQUENCE commits_id_seq OWNED BY commits.id;
 
 
+--
+-- Name: tags; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE tags (
+    id bigint NOT NULL,
+    repository_id bigint NOT NULL,
+    tagger_id bigint,
+    name character varying NOT NULL,
+    target_vcs_id character varying NOT NULL,
+    is_annotated boolean NOT NULL,
+    message text,
+    tag_date timestamp with time zone,
+    version character varying,
+    is_release boolean NOT NULL,
+    is_prerelease boolean NOT NULL
+);
+
+
+--
+-- Name: tags_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE tags_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: tags_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE tags_id_seq OWNED BY tags.id;
+
+
+--
+-- Name: commit_notes; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE commit_notes (
+    id bigint NOT NULL,
+    commit_id bigint NOT NULL,
+    notes_ref character varying NOT NULL,
+    note text
+);
+
+
+--
+-- Name: commit_notes_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE commit_notes_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: commit_notes_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE commit_notes_id_seq OWNED BY commit_notes.id;
+
+
+--
+-- Name: identities; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE identities (
+    id bigint NOT NULL,
+    cluster_id bigint NOT NULL,
+    user_id bigint,
+    name character varying NOT NULL,
+    email character varying NOT NULL,
+    occurrences integer NOT NULL,
+    confidence double precision NOT NULL
+);
+
+
+--
+-- Name: identities_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE identities_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: identities_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE identities_id_seq OWNED BY identities.id;
+
+
+--
+-- Name: file_coupling; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE file_coupling (
+    id bigint NOT NULL,
+    repository_id bigint NOT NULL,
+    file character varying NOT NULL,
+    coupled_file character varying NOT NULL,
+    commits integer NOT NULL,
+    file_commits integer NOT NULL,
+    coupled_file_commits integer NOT NULL,
+    support double precision NOT NULL,
+    confidence double precision NOT NULL,
+    reverse_confidence double precision NOT NULL
+);
+
+
+--
+-- Name: file_coupling_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE file_coupling_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: file_coupling_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE file_coupling_id_seq OWNED BY file_coupling.id;
+
+
+--
+-- Name: id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY commit_coauthors ALTER COLUMN id SET DEFAULT nextval('commit_coauthors_id_seq'::regclass);
+
+
 --
 -- Name: id; Type: DEFAULT; Schema: public; Owner: -
 --
@@ -99,6 +294,42 @@ ALTER TABLE ONLY commit_diff_deltas ALTER COLUMN id SET DEFAULT nextval('commit_
 ALTER TABLE ONLY commits ALTER COLUMN id SET DEFAULT nextval('commits_id_seq'::regclass);
 
 
+--
+-- Name: id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY tags ALTER COLUMN id SET DEFAULT nextval('tags_id_seq'::regclass);
+
+
+--
+-- Name: id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY commit_notes ALTER COLUMN id SET DEFAULT nextval('commit_notes_id_seq'::regclass);
+
+
+--
+-- Name: id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY identities ALTER COLUMN id SET DEFAULT nextval('identities_id_seq'::regclass);
+
+
+--
+-- Name: id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY file_coupling ALTER COLUMN id SET DEFAULT nextval('file_coupling_id_seq'::regclass);
+
+
+--
+-- Name: commit_coauthors_pk; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY commit_coauthors
+    ADD CONSTRAINT commit_coauthors_pk PRIMARY KEY (id);
+
+
 --
 -- Name: commit_diff_deltas_pk; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -115,6 +346,45 @@ ALTER TABLE ONLY commits
     ADD CONSTRAINT commits_pk PRIMARY KEY (id);
 
 
+--
+-- Name: tags_pk; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY tags
+    ADD CONSTRAINT tags_pk PRIMARY KEY (id);
+
+
+--
+-- Name: commit_notes_pk; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY commit_notes
+    ADD CONSTRAINT commit_notes_pk PRIMARY KEY (id);
+
+
+--
+-- Name: identities_pk; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY identities
+    ADD CONSTRAINT identities_pk PRIMARY KEY (id);
+
+
+--
+-- Name: file_coupling_pk; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY file_coupling
+    ADD CONSTRAINT file_coupling_pk PRIMARY KEY (id);
+
+
+--
+-- Name: fki_commit_coauthors_fk_commits; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX fki_commit_coauthors_fk_commits ON commit_coauthors USING btree (commit_id);
+
+
 --
 -- Name: fki_commit_diff_deltas_fk_commits; Type: INDEX; Schema: public; Owner: -
 --
@@ -129,6 +399,42 @@ CREATE INDEX fki_commit_diff_deltas_fk_commits ON commit_diff_deltas USING btree
 CREATE INDEX fki_commits_fk_repositories ON commits USING btree (repository_id);
 
 
+--
+-- Name: fki_tags_fk_repositories; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX fki_tags_fk_repositories ON tags USING btree (repository_id);
+
+
+--
+-- Name: fki_commit_notes_fk_commits; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX fki_commit_notes_fk_commits ON commit_notes USING btree (commit_id);
+
+
+--
+-- Name: fki_file_coupling_fk_repositories; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX fki_file_coupling_fk_repositories ON file_coupling USING btree (repository_id);
+
+
+--
+-- Name: identities_cluster_id_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX identities_cluster_id_idx ON identities USING btree (cluster_id);
+
+
+--
+-- Name: commit_coauthors_fk_commits; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY commit_coauthors
+    ADD CONSTRAINT commit_coauthors_fk_commits FOREIGN KEY (commit_id) REFERENCES commits(id);
+
+
 --
 -- Name: commit_diff_deltas_fk_commits; Type: FK CONSTRAINT; Schema: public; Owner: -
 --
@@ -145,6 +451,30 @@ ALTER TABLE ONLY commits
     ADD CONSTRAINT commits_fk_repositories FOREIGN KEY (repository_id) REFERENCES repositories(id);
 
 
+--
+-- Name: tags_fk_repositories; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY tags
+    ADD CONSTRAINT tags_fk_repositories FOREIGN KEY (repository_id) REFERENCES repositories(id);
+
+
+--
+-- Name: commit_notes_fk_commits; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY commit_notes
+    ADD CONSTRAINT commit_notes_fk_commits FOREIGN KEY (commit_id) REFERENCES commits(id);
+
+
+--
+-- Name: file_coupling_fk_repositories; Type: FK CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY file_coupling
+    ADD CONSTRAINT file_coupling_fk_repositories FOREIGN KEY (repository_id) REFERENCES repositories(id);
+
+
 --
 -- PostgreSQL database dump complete
 --
@@ -0,0 +1,54 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// csvHeader is the header of the CSV export of clusters.
+var csvHeader = []string{
+	"cluster_id",
+	"cluster_name",
+	"cluster_email",
+	"name",
+	"email",
+	"occurrences",
+	"confidence",
+}
+
+// WriteCSV writes clusters as CSV, one line per member, for manual review.
+// Clusters of a single identity are left out as there is nothing to review.
+func WriteCSV(w io.Writer, clusters []Cluster) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, c := range clusters {
+		if len(c.Members) < 2 {
+			continue
+		}
+		for _, m := range c.Members {
+			err := cw.Write([]string{
+				strconv.FormatInt(c.ID, 10),
+				c.Name,
+				c.Email,
+				m.Name,
+				m.Email,
+				strconv.Itoa(m.Occurrences),
+				strconv.FormatFloat(m.Confidence, 'f', 2, 64),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,411 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package identity clusters developer identities, ie name and email pairs,
+// which are likely to belong to the same developer.
+//
+// Identities are compared once normalized: emails are lowercased and
+// stripped of "+tag" suffixes, GitHub noreply addresses are reduced to the
+// login of the developer and names are lowercased, stripped of diacritics and
+// punctuation and their tokens sorted, so that swapped first and last names
+// compare equal. Identities sharing an email are always merged, unless the
+// email is empty or a placeholder such as root@localhost, whereas the other
+// ones are merged when the confidence that they belong to the same
+// developer, based on the similarity of their names, their email local parts
+// and GitHub logins, reaches a threshold.
+package identity
+
+import (
+	"hash/fnv"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DevMine/repotool/model"
+)
+
+const (
+	// sameNameConfidence is the confidence that two identities with the same
+	// normalized name belong to the same developer. It is not 1 as different
+	// developers may share a name.
+	sameNameConfidence = 0.95
+
+	// similarNamePenalty is applied to the similarity of names which are
+	// similar but not the same, such as "Jon Doe" and "John Doe".
+	similarNamePenalty = 0.9
+
+	// singleTokenPenalty is applied to the similarity of names made of a
+	// single token, which are too common to be trusted as much as full
+	// names.
+	singleTokenPenalty = 0.75
+
+	// localPartConfidence is the confidence that two identities sharing the
+	// local part of their emails belong to the same developer.
+	localPartConfidence = 0.85
+
+	// loginConfidence is the confidence that an identity whose email local
+	// part or name matches the GitHub login of another identity belongs to
+	// the same developer.
+	loginConfidence = 0.9
+
+	// minLocalPartLen is the minimum length of an email local part for it to
+	// be used to match identities.
+	minLocalPartLen = 4
+
+	// maxBlockSize is the maximum number of identities sharing a name token,
+	// local part or login to be compared with each other. Larger blocks,
+	// such as the ones of common first names, are skipped to keep the number
+	// of comparisons manageable; identities are still compared through their
+	// other, less common, tokens.
+	maxBlockSize = 500
+)
+
+// Member is an identity which is part of a cluster.
+type Member struct {
+	// Name is the name of the identity.
+	Name string `json:"name"`
+
+	// Email is the email of the identity.
+	Email string `json:"email"`
+
+	// Occurrences is the number of times the identity was added.
+	Occurrences int `json:"occurrences"`
+
+	// Confidence, between 0 and 1, is the confidence that the identity
+	// belongs to the developer the cluster stands for. It is the highest
+	// confidence of the links between the identity and the other members of
+	// the cluster, or 1 for clusters of a single identity.
+	Confidence float64 `json:"confidence"`
+}
+
+// Cluster is a group of identities believed to belong to the same developer.
+type Cluster struct {
+	// ID identifies the cluster. It is derived from the smallest identity of
+	// the cluster, by email then name, so that a cluster keeps its ID from
+	// one merge to the next as long as that identity is part of it.
+	ID int64 `json:"id"`
+
+	// Name is the name of the most frequent identity of the cluster.
+	Name string `json:"name"`
+
+	// Email is the email of the most frequent identity of the cluster.
+	Email string `json:"email"`
+
+	// Members is the list of identities of the cluster, the most frequent
+	// first.
+	Members []Member `json:"members"`
+}
+
+// identity is a name and email pair along with its normalized forms.
+type identity struct {
+	name        string
+	email       string
+	occurrences int
+
+	normEmail string
+	local     string
+	login     string
+	tokens    []string
+	normName  string
+	compact   string
+}
+
+// link is a link between two identities.
+type link struct {
+	a, b       int
+	confidence float64
+}
+
+// Merger collects identities and merges the ones belonging to the same
+// developer. It is safe for concurrent use.
+type Merger struct {
+	nameThreshold  float64
+	mergeThreshold float64
+
+	mu         sync.Mutex
+	identities []*identity
+	index      map[[2]string]int
+	links      []link
+}
+
+// NewMerger creates a new Merger. nameThreshold is the minimum similarity,
+// between 0 and 1, of the names of two identities for them to be linked on
+// the basis of their names. mergeThreshold is the minimum confidence,
+// between 0 and 1, for two linked identities to be merged.
+func NewMerger(nameThreshold, mergeThreshold float64) *Merger {
+	return &Merger{
+		nameThreshold:  nameThreshold,
+		mergeThreshold: mergeThreshold,
+		index:          make(map[[2]string]int),
+	}
+}
+
+// Add adds the identity made of name and email.
+func (m *Merger) Add(name, email string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.add(name, email)
+}
+
+// AddDeveloper adds the raw identity of a developer and, if it differs, their
+// canonical identity. As the latter is given by a mailmap, both identities
+// are always merged.
+func (m *Merger) AddDeveloper(d model.Developer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	raw := m.add(d.Name, d.Email)
+	if len(d.CanonicalEmail) == 0 || (d.CanonicalName == d.Name && d.CanonicalEmail == d.Email) {
+		return
+	}
+	canonical := m.add(d.CanonicalName, d.CanonicalEmail)
+	m.links = append(m.links, link{raw, canonical, 1})
+}
+
+// add adds an identity and returns its index. m.mu must be held.
+func (m *Merger) add(name, email string) int {
+	key := [2]string{name, email}
+	if i, ok := m.index[key]; ok {
+		m.identities[i].occurrences++
+		return i
+	}
+
+	id := &identity{name: name, email: email, occurrences: 1}
+	id.normEmail, id.local, id.login = normalizeEmail(email)
+	if isPlaceholderEmail(id.normEmail) {
+		// unrelated developers share placeholder emails
+		id.normEmail, id.local = "", ""
+	}
+	id.tokens = nameTokens(name)
+	id.normName = strings.Join(id.tokens, " ")
+	id.compact = strings.Join(id.tokens, "")
+
+	m.identities = append(m.identities, id)
+	m.index[key] = len(m.identities) - 1
+	return len(m.identities) - 1
+}
+
+// Clusters merges the identities added so far and returns the resulting
+// clusters, sorted by name.
+func (m *Merger) Clusters() []Cluster {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(m.identities)
+	parents := make([]int, n)
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+
+	confidences := make([]float64, n)
+	merge := func(l link) {
+		if l.confidence < m.mergeThreshold {
+			return
+		}
+		parents[find(l.a)] = find(l.b)
+		for _, i := range []int{l.a, l.b} {
+			if l.confidence > confidences[i] {
+				confidences[i] = l.confidence
+			}
+		}
+	}
+
+	for _, l := range m.links {
+		merge(l)
+	}
+	for _, l := range m.compare() {
+		merge(l)
+	}
+
+	groups := make(map[int][]int)
+	for i := range m.identities {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+
+	clusters := make([]Cluster, 0, len(groups))
+	for _, group := range groups {
+		var c Cluster
+		for _, i := range group {
+			id := m.identities[i]
+			confidence := confidences[i]
+			if len(group) == 1 {
+				confidence = 1
+			}
+			c.Members = append(c.Members, Member{
+				Name:        id.name,
+				Email:       id.email,
+				Occurrences: id.occurrences,
+				Confidence:  confidence,
+			})
+		}
+		sort.Sort(membersByOccurrences(c.Members))
+		c.ID = clusterID(c.Members)
+		c.Name = c.Members[0].Name
+		c.Email = c.Members[0].Email
+		clusters = append(clusters, c)
+	}
+
+	sort.Sort(clustersByName(clusters))
+	return clusters
+}
+
+// compare compares identities likely to be linked, that is identities
+// sharing their normalized email, unless empty or a placeholder, or one of
+// their name tokens, concatenated name, email local part and GitHub login,
+// and returns the links found between them.
+func (m *Merger) compare() []link {
+	blocks := make(map[string][]int)
+	for i, id := range m.identities {
+		var keys []string
+		if len(id.normEmail) > 0 {
+			keys = append(keys, "email:"+id.normEmail)
+		}
+		for _, t := range id.tokens {
+			keys = append(keys, "name:"+t)
+		}
+		if len(id.tokens) > 1 {
+			keys = append(keys, "name:"+id.compact)
+		}
+		if len(id.local) >= minLocalPartLen && !genericLocalParts[id.local] {
+			keys = append(keys, "name:"+id.local)
+		}
+		if len(id.login) > 0 {
+			keys = append(keys, "name:"+id.login)
+		}
+		seen := make(map[string]bool, len(keys))
+		for _, k := range keys {
+			// a local part or login may also be a name token
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			blocks[k] = append(blocks[k], i)
+		}
+	}
+
+	var links []link
+	compared := make(map[[2]int]bool)
+	for key, block := range blocks {
+		if strings.HasPrefix(key, "email:") {
+			// identities sharing an email are always merged
+			for _, i := range block[1:] {
+				links = append(links, link{block[0], i, 1})
+			}
+			continue
+		}
+		if len(block) > maxBlockSize {
+			continue
+		}
+
+		for x, i := range block {
+			for _, j := range block[x+1:] {
+				if compared[[2]int{i, j}] {
+					continue
+				}
+				compared[[2]int{i, j}] = true
+
+				if c := m.confidence(m.identities[i], m.identities[j]); c > 0 {
+					links = append(links, link{i, j, c})
+				}
+			}
+		}
+	}
+
+	return links
+}
+
+// confidence returns the confidence, between 0 and 1, that two identities
+// belong to the same developer.
+func (m *Merger) confidence(a, b *identity) float64 {
+	if len(a.normEmail) > 0 && a.normEmail == b.normEmail {
+		return 1
+	}
+
+	var c float64
+	if len(a.normName) > 0 && len(b.normName) > 0 {
+		if a.normName == b.normName {
+			c = sameNameConfidence
+		} else if sim := jaroWinkler(a.normName, b.normName); sim >= m.nameThreshold {
+			c = sim * similarNamePenalty
+		}
+		if len(a.tokens) < 2 || len(b.tokens) < 2 {
+			c *= singleTokenPenalty
+		}
+	}
+
+	if a.local == b.local && len(a.local) >= minLocalPartLen && !genericLocalParts[a.local] {
+		c = maxFloat(c, localPartConfidence)
+	}
+
+	for _, pair := range [][2]*identity{{a, b}, {b, a}} {
+		x, y := pair[0], pair[1]
+		if len(x.login) > 0 && (x.login == y.local || x.login == y.compact) {
+			c = maxFloat(c, loginConfidence)
+		}
+	}
+
+	return c
+}
+
+// clusterID returns the ID of the cluster made of members: a positive hash
+// of the smallest member, by email then name.
+func clusterID(members []Member) int64 {
+	smallest := members[0]
+	for _, m := range members[1:] {
+		if m.Email < smallest.Email || (m.Email == smallest.Email && m.Name < smallest.Name) {
+			smallest = m
+		}
+	}
+
+	h := fnv.New64a()
+	io.WriteString(h, smallest.Email)
+	h.Write([]byte{0})
+	io.WriteString(h, smallest.Name)
+	return int64(h.Sum64() >> 1)
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// membersByOccurrences implements sort.Interface to sort members by
+// decreasing number of occurrences, then by email and name.
+type membersByOccurrences []Member
+
+func (m membersByOccurrences) Len() int      { return len(m) }
+func (m membersByOccurrences) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m membersByOccurrences) Less(i, j int) bool {
+	if m[i].Occurrences != m[j].Occurrences {
+		return m[i].Occurrences > m[j].Occurrences
+	}
+	if m[i].Email != m[j].Email {
+		return m[i].Email < m[j].Email
+	}
+	return m[i].Name < m[j].Name
+}
+
+// clustersByName implements sort.Interface to sort clusters by name, then by
+// email.
+type clustersByName []Cluster
+
+func (c clustersByName) Len() int      { return len(c) }
+func (c clustersByName) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c clustersByName) Less(i, j int) bool {
+	if c[i].Name != c[j].Name {
+		return c[i].Name < c[j].Name
+	}
+	return c[i].Email < c[j].Email
+}
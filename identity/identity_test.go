@@ -0,0 +1,133 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/DevMine/repotool/model"
+)
+
+// clusterGroups returns the identities of each cluster as a sorted, comma
+// separated, list of "Name <email>" strings. Groups are sorted.
+func clusterGroups(clusters []Cluster) []string {
+	var groups []string
+	for _, c := range clusters {
+		var g []string
+		for _, m := range c.Members {
+			g = append(g, m.Name+" <"+m.Email+">")
+		}
+		sort.Strings(g)
+		groups = append(groups, strings.Join(g, ", "))
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+func TestMergerClusters(t *testing.T) {
+	m := NewMerger(0.9, 0.8)
+	m.Add("Jane Doe", "jane@corp.io")
+	m.Add("Jane Doe", "jane@corp.io")
+	m.Add("Doe, Jane", "jane.doe@gmail.com")
+	m.Add("J. Smith", "JOHN+git@Corp.io")
+	m.Add("John Smith", "john@corp.io")
+	m.Add("Alice Martin", "root@localhost")
+	m.Add("Bob Stone", "root@localhost")
+	m.Add("Carol White", "")
+	m.Add("Dan Black", "")
+	m.Add("Erin", "12345+erinkay@users.noreply.github.com")
+	m.Add("Erin Kay", "erinkay@corp.io")
+	m.Add("Frank", "admin@corp.io")
+	m.Add("Grace", "admin@other.io")
+	m.AddDeveloper(model.Developer{
+		Name:           "hj",
+		Email:          "hj@laptop",
+		CanonicalName:  "Heidi Jones",
+		CanonicalEmail: "heidi@corp.io",
+	})
+
+	want := []string{
+		"Alice Martin <root@localhost>",
+		"Bob Stone <root@localhost>",
+		"Carol White <>",
+		"Dan Black <>",
+		"Doe, Jane <jane.doe@gmail.com>, Jane Doe <jane@corp.io>",
+		"Erin <12345+erinkay@users.noreply.github.com>, Erin Kay <erinkay@corp.io>",
+		"Frank <admin@corp.io>",
+		"Grace <admin@other.io>",
+		"Heidi Jones <heidi@corp.io>, hj <hj@laptop>",
+		"J. Smith <JOHN+git@Corp.io>, John Smith <john@corp.io>",
+	}
+
+	clusters := m.Clusters()
+	if got := clusterGroups(clusters); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	for _, c := range clusters {
+		if c.Email == "jane@corp.io" {
+			if c.Name != "Jane Doe" || c.Members[0].Occurrences != 2 {
+				t.Errorf("Jane Doe: got %+v", c)
+			}
+			for _, mb := range c.Members {
+				if mb.Confidence != sameNameConfidence {
+					t.Errorf("%s: got confidence %v, want %v", mb.Name, mb.Confidence, sameNameConfidence)
+				}
+			}
+		}
+		if len(c.Members) == 1 && c.Members[0].Confidence != 1 {
+			t.Errorf("%s: got confidence %v, want 1", c.Name, c.Members[0].Confidence)
+		}
+	}
+}
+
+func TestMergerClusterIDs(t *testing.T) {
+	identities := [][2]string{
+		{"Jane Doe", "jane@corp.io"},
+		{"Doe, Jane", "jane.doe@gmail.com"},
+		{"John Smith", "john@corp.io"},
+		{"Alice Martin", "alice@corp.io"},
+	}
+
+	ids := func(identities [][2]string) map[string]int64 {
+		m := NewMerger(0.9, 0.8)
+		for _, id := range identities {
+			m.Add(id[0], id[1])
+		}
+		ids := make(map[string]int64)
+		for _, c := range m.Clusters() {
+			for _, mb := range c.Members {
+				ids[mb.Email] = c.ID
+			}
+		}
+		return ids
+	}
+
+	first := ids(identities)
+	if len(first) != 4 || first["jane@corp.io"] != first["jane.doe@gmail.com"] || first["jane@corp.io"] == first["john@corp.io"] {
+		t.Fatalf("unexpected cluster IDs: %v", first)
+	}
+	for _, id := range first {
+		if id <= 0 {
+			t.Errorf("got non positive cluster ID %d", id)
+		}
+	}
+
+	// IDs must not depend on the order of identities nor on other clusters
+	reversed := make([][2]string, 0, len(identities)+1)
+	reversed = append(reversed, [2]string{"Bob Stone", "bob@corp.io"})
+	for i := len(identities) - 1; i >= 0; i-- {
+		reversed = append(reversed, identities[i])
+	}
+	second := ids(reversed)
+	for email, id := range first {
+		if second[email] != id {
+			t.Errorf("%s: got cluster ID %d, then %d", email, id, second[email])
+		}
+	}
+}
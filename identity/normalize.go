@@ -0,0 +1,134 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// githubNoreplyDomain is the domain of the email addresses GitHub uses to
+// hide the actual email addresses of its users.
+const githubNoreplyDomain = "users.noreply.github.com"
+
+// gmailDomains are the domains of Gmail addresses, which ignore dots in
+// their local part.
+var gmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+}
+
+// genericLocalParts are email local parts too common to tell anything about
+// the developer using them.
+var genericLocalParts = map[string]bool{
+	"admin":     true,
+	"contact":   true,
+	"dev":       true,
+	"developer": true,
+	"git":       true,
+	"info":      true,
+	"mail":      true,
+	"me":        true,
+	"noreply":   true,
+	"root":      true,
+	"user":      true,
+}
+
+// placeholderEmails are emails used by tools and developers who did not
+// configure theirs. They are shared by unrelated developers.
+var placeholderEmails = map[string]bool{
+	"nobody@nowhere":     true,
+	"none@none":          true,
+	"noreply@github.com": true,
+	"unknown@unknown":    true,
+}
+
+// placeholderDomains are the domains of placeholder emails, such as
+// root@localhost, user@example.com or the user@host.(none) emails git makes
+// up when none is configured.
+var placeholderDomains = []string{
+	"(none)",
+	"example.com",
+	"example.net",
+	"example.org",
+	"invalid",
+	"localdomain",
+	"localhost",
+}
+
+// isPlaceholderEmail tells whether a normalized email is a placeholder, as
+// opposed to the actual email of a developer.
+func isPlaceholderEmail(email string) bool {
+	if placeholderEmails[email] {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, d := range placeholderDomains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEmail returns the canonical form of an email address: it is
+// lowercased, "+tag" suffixes of the local part are removed, as are dots of
+// Gmail addresses, and GitHub noreply addresses lose their user ID prefix
+// (12345+login@users.noreply.github.com).
+// It also returns the local part of the normalized email and, for GitHub
+// noreply addresses, the GitHub login of the developer.
+func normalizeEmail(email string) (normalized, local, login string) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email, email, ""
+	}
+	local, domain := email[:at], email[at+1:]
+
+	if domain == githubNoreplyDomain {
+		if plus := strings.Index(local, "+"); plus >= 0 {
+			local = local[plus+1:]
+		}
+		return local + "@" + domain, local, local
+	}
+
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	if gmailDomains[domain] {
+		local = strings.Replace(local, ".", "", -1)
+		domain = "gmail.com"
+	}
+
+	return local + "@" + domain, local, ""
+}
+
+// nameTokens returns the tokens of a name once lowercased and stripped of
+// diacritics and punctuation, sorted so that swapped first and last names
+// ("Doe, John" and "John Doe") give the same tokens.
+func nameTokens(name string) []string {
+	var b []rune
+	for _, r := range norm.NFD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// diacritic
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b = append(b, unicode.ToLower(r))
+		default:
+			b = append(b, ' ')
+		}
+	}
+
+	tokens := strings.Fields(string(b))
+	sort.Strings(tokens)
+	return tokens
+}
@@ -0,0 +1,85 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email      string
+		normalized string
+		local      string
+		login      string
+	}{
+		{"", "", "", ""},
+		{"jane", "jane", "jane", ""},
+		{" Jane.Doe@Corp.IO ", "jane.doe@corp.io", "jane.doe", ""},
+		{"jane+git@corp.io", "jane@corp.io", "jane", ""},
+		{"+jane@corp.io", "+jane@corp.io", "+jane", ""},
+		{"Jane.Doe+spam@GoogleMail.com", "janedoe@gmail.com", "janedoe", ""},
+		{"jane.doe@gmail.com", "janedoe@gmail.com", "janedoe", ""},
+		{"12345+JaneDoe@users.noreply.github.com", "janedoe@users.noreply.github.com", "janedoe", "janedoe"},
+		{"janedoe@users.noreply.github.com", "janedoe@users.noreply.github.com", "janedoe", "janedoe"},
+		{"a@b@corp.io", "a@b@corp.io", "a@b", ""},
+	}
+
+	for _, tt := range tests {
+		normalized, local, login := normalizeEmail(tt.email)
+		if normalized != tt.normalized || local != tt.local || login != tt.login {
+			t.Errorf("normalizeEmail(%q) = %q, %q, %q, want %q, %q, %q", tt.email,
+				normalized, local, login, tt.normalized, tt.local, tt.login)
+		}
+	}
+}
+
+func TestIsPlaceholderEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"", false},
+		{"jane@corp.io", false},
+		{"root@localhost", true},
+		{"jane@localhost.localdomain", true},
+		{"none@none", true},
+		{"noreply@github.com", true},
+		{"jane@users.noreply.github.com", false},
+		{"user@example.com", true},
+		{"jane@mail.example.org", true},
+		{"jane@myexample.org", false},
+		{"jane@laptop.(none)", true},
+		{"localhost", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPlaceholderEmail(tt.email); got != tt.want {
+			t.Errorf("isPlaceholderEmail(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestNameTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"", []string{}},
+		{"  ", []string{}},
+		{"Jane Doe", []string{"doe", "jane"}},
+		{"Doe, Jane", []string{"doe", "jane"}},
+		{"Jérôme O'Brien-Smith", []string{"brien", "jerome", "o", "smith"}},
+		{"François Ç.", []string{"c", "francois"}},
+		{"jdoe42", []string{"jdoe42"}},
+	}
+
+	for _, tt := range tests {
+		if got := nameTokens(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("nameTokens(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package identity
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings, between 0
+// (no similarity) and 1 (identical strings).
+func jaroWinkler(s1, s2 string) float64 {
+	a, b := []rune(s1), []rune(s2)
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	window := max(len(a), len(b))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	aMatches := make([]bool, len(a))
+	bMatches := make([]bool, len(b))
+	var matches int
+	for i := range a {
+		lo, hi := max(0, i-window), min(len(b), i+window+1)
+		for j := lo; j < hi; j++ {
+			if bMatches[j] || a[i] != b[j] {
+				continue
+			}
+			aMatches[i], bMatches[j] = true, true
+			matches++
+			break
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	var transpositions, k int
+	for i := range a {
+		if !aMatches[i] {
+			continue
+		}
+		for !bMatches[k] {
+			k++
+		}
+		if a[i] != b[k] {
+			transpositions++
+		}
+		k++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(a)) + m/float64(len(b)) + (m-float64(transpositions)/2)/m) / 3
+
+	// common prefix, up to 4 characters
+	var prefix int
+	for prefix < min(4, min(len(a), len(b))) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
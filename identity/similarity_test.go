@@ -0,0 +1,38 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package identity
+
+import (
+	"math"
+	"testing"
+)
+
+func TestJaroWinkler(t *testing.T) {
+	tests := []struct {
+		s1, s2 string
+		want   float64
+	}{
+		{"", "", 1},
+		{"", "a", 0},
+		{"a", "", 0},
+		{"abc", "xyz", 0},
+		{"john doe", "john doe", 1},
+		{"martha", "marhta", 0.961},
+		{"dwayne", "duane", 0.840},
+		{"dixon", "dicksonx", 0.813},
+		{"jon doe", "john doe", 0.967},
+		{"jérôme", "jérome", 0.922},
+	}
+
+	for _, tt := range tests {
+		got := jaroWinkler(tt.s1, tt.s2)
+		if math.Abs(got-tt.want) > 0.001 {
+			t.Errorf("jaroWinkler(%q, %q) = %.3f, want %.3f", tt.s1, tt.s2, got, tt.want)
+		}
+		if sym := jaroWinkler(tt.s2, tt.s1); math.Abs(sym-got) > 1e-9 {
+			t.Errorf("jaroWinkler(%q, %q) = %.3f, not symmetric", tt.s2, tt.s1, sym)
+		}
+	}
+}
@@ -15,20 +15,54 @@ type Commit struct {
 	// Message represents the commits message.
 	Message string `json:"message"`
 
+	// Subject is the first paragraph of the commit message, its lines being
+	// joined by spaces.
+	Subject string `json:"subject"`
+
+	// Body is the commit message without its subject.
+	Body string `json:"body,omitempty"`
+
+	// IssueRefs is the list of references to issues and pull requests
+	// found in the commit message.
+	IssueRefs []IssueRef `json:"issue_refs,omitempty"`
+
+	// Trailers is the list of trailers found at the end of the commit
+	// message (Signed-off-by, Co-authored-by, Reviewed-by, ...).
+	Trailers []Trailer `json:"trailers,omitempty"`
+
+	// Notes maps notes references (refs/notes/commits, ...) to the note
+	// attached to the commit under this reference.
+	Notes map[string]string `json:"notes,omitempty"`
+
 	// Author represents the developer that authored the changes made
 	// in the commit.
 	Author Developer `json:"author"`
 
+	// CoAuthors represents the developers credited as co-authors of the
+	// changes made in the commit by Co-authored-by trailers.
+	CoAuthors []Developer `json:"co_authors,omitempty"`
+
 	// Committer represents the developer that commited the changes.
 	// Most of the time, the committer is also the author.
 	Committer Developer `json:"committer"`
 
+	// Signature represents the signature of the commit, if signed.
+	Signature *Signature `json:"signature,omitempty"`
+
 	// AuthorDate represents the date when the commit was created.
 	AuthorDate time.Time `json:"author_date"`
 
 	// CommitDate represents the date when the commit was committed.
 	CommitDate time.Time `json:"commit_date"`
 
+	// AuthorTZOffset represents the offset from UTC, in minutes, of the
+	// timezone of the author when the commit was created.
+	AuthorTZOffset int `json:"author_tz_offset"`
+
+	// CommitterTZOffset represents the offset from UTC, in minutes, of the
+	// timezone of the committer when the commit was committed.
+	CommitterTZOffset int `json:"committer_tz_offset"`
+
 	// DiffDelta represents the changes maed by the commit.
 	DiffDelta []DiffDelta `json:"diff_delta,omitempty"`
 
@@ -41,4 +75,54 @@ type Commit struct {
 
 	// DeletionsCount represents how many lines have been removed.
 	DeletionsCount int `json:"deletions_count"`
+
+	// Languages breaks the changes made by the commit down by programming
+	// language. It is only available along with DiffDelta.
+	Languages map[string]LanguageStats `json:"languages,omitempty"`
+}
+
+// Trailer represents a "key: value" line found at the end of a commit
+// message, such as "Signed-off-by: John Doe <john@doe.com>".
+type Trailer struct {
+	// Key is the key of the trailer, as written in the message.
+	Key string `json:"key"`
+
+	// Value is the value of the trailer.
+	Value string `json:"value"`
+}
+
+// IssueRef represents a reference to an issue or a pull request found in a
+// commit message, such as "fixes #12", "GH-123", "JIRA-456" or the URL of an
+// issue.
+type IssueRef struct {
+	// Ref is the reference, as written in the message.
+	Ref string `json:"ref"`
+
+	// Keyword is the lowercased keyword preceding the reference (fixes,
+	// closes, refs, ...), if any.
+	Keyword string `json:"keyword,omitempty"`
+
+	// Repository is the repository the issue belongs to (owner/repo), when
+	// given.
+	Repository string `json:"repository,omitempty"`
+
+	// ID is the identifier of the issue: its number, or its key for
+	// trackers such as JIRA.
+	ID string `json:"id"`
+
+	// URL is the URL of the issue, when the reference is one.
+	URL string `json:"url,omitempty"`
+}
+
+// LanguageStats represents the changes made by a commit to the files written
+// in a given programming language.
+type LanguageStats struct {
+	// FileChangedCount represents how many files have been touched.
+	FileChangedCount int `json:"file_changed_count"`
+
+	// InsertionsCount represents how many new lines have been added.
+	InsertionsCount int `json:"insertions_count"`
+
+	// DeletionsCount represents how many lines have been removed.
+	DeletionsCount int `json:"deletions_count"`
 }
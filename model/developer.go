@@ -12,4 +12,12 @@ type Developer struct {
 
 	// Email is the email of a developer.
 	Email string `json:"email"`
+
+	// CanonicalName is the name of the developer once mapped by the
+	// .mailmap of the repository, if any. It equals Name otherwise.
+	CanonicalName string `json:"canonical_name"`
+
+	// CanonicalEmail is the email of the developer once mapped by the
+	// .mailmap of the repository, if any. It equals Email otherwise.
+	CanonicalEmail string `json:"canonical_email"`
 }
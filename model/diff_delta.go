@@ -11,6 +11,22 @@ var (
 	StatusModified = "modified"
 	StatusRenamed  = "renamed"
 	StatusCopied   = "copied"
+
+	// StatusTypeChange is the status of a file whose type changed, for
+	// instance from a regular file to a symbolic link.
+	StatusTypeChange = "typechange"
+)
+
+// Category of a file touched by a commit.
+const (
+	CategorySource        = "source"
+	CategoryTest          = "test"
+	CategoryDocumentation = "documentation"
+	CategoryBuild         = "build"
+	CategoryGenerated     = "generated"
+	CategoryVendored      = "vendored"
+	CategoryBinary        = "binary"
+	CategoryOther         = "other"
 )
 
 // DiffDelta represents a delta difference between a commit and its parent.
@@ -18,8 +34,11 @@ type DiffDelta struct {
 	// Patch represents the difference between a commit and its parent.
 	Patch *string `json:"patch,omitempty"`
 
+	// DiffHunks is a structured representation of the patch.
+	DiffHunks []Hunk `json:"diff_hunks,omitempty"`
+
 	// Status gives information about whether the file has been added, deleted
-	// modified, renamed of copied.
+	// modified, renamed, copied or whether its type changed.
 	Status *string `json:"status,omitempty"`
 
 	// Binary gives information about whether the file is a binary or not.
@@ -37,4 +56,41 @@ type DiffDelta struct {
 
 	// NewFilePath represents the path to the new file.
 	NewFilePath *string `json:"new_file_path,omitempty"`
+
+	// OldFileMode represents the mode of the old file, in octal notation
+	// (eg 100644 for a regular file, 100755 for an executable file).
+	OldFileMode *string `json:"old_file_mode,omitempty"`
+
+	// NewFileMode represents the mode of the new file, in octal notation.
+	NewFileMode *string `json:"new_file_mode,omitempty"`
+
+	// OldBlobID represents the VCS identifier of the old file content.
+	OldBlobID *string `json:"old_blob_id,omitempty"`
+
+	// NewBlobID represents the VCS identifier of the new file content.
+	NewBlobID *string `json:"new_blob_id,omitempty"`
+
+	// Submodule gives information about whether the file is a submodule, in
+	// which case the blob IDs are the IDs of the commits the submodule
+	// points to.
+	Submodule *bool `json:"submodule,omitempty"`
+
+	// Language is the programming language of the file (Go, C++, ...), if
+	// known.
+	Language *string `json:"language,omitempty"`
+
+	// Category tells what the file is about: source code, tests,
+	// documentation, build system, generated code, vendored code, binary
+	// file or other.
+	Category *string `json:"category,omitempty"`
+
+	// Insertions represents how many lines have been added to the file.
+	Insertions *int `json:"insertions,omitempty"`
+
+	// Deletions represents how many lines have been removed from the file.
+	Deletions *int `json:"deletions,omitempty"`
+
+	// Hunks represents how many hunks the changes made to the file consist
+	// of.
+	Hunks *int `json:"hunks,omitempty"`
 }
@@ -0,0 +1,64 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package model
+
+// File represents a file of a repository, tracked across renames.
+type File struct {
+	// ID identifies the file. It is computed from the oldest commit known to
+	// have touched the file and the path of the file in this commit, hence
+	// it does not change as long as the history of the repository is not
+	// rewritten.
+	ID string `json:"id"`
+
+	// Path is the latest path of the file.
+	Path string `json:"path"`
+
+	// Paths is the list of the paths the file had, the latest one first.
+	Paths []string `json:"paths"`
+
+	// Deleted tells whether the file was deleted.
+	Deleted bool `json:"deleted"`
+
+	// CopiedFrom is the ID of the file this file was copied from, if it was
+	// created as a copy.
+	CopiedFrom string `json:"copied_from,omitempty"`
+
+	// Changes is the list of changes made to the file, the latest one first.
+	Changes []FileChange `json:"changes"`
+}
+
+// FileChange represents a change made to a file by a commit.
+type FileChange struct {
+	// Commit is the VCS ID of the commit.
+	Commit string `json:"commit"`
+
+	// Status tells whether the file was added, deleted, modified, renamed,
+	// copied or whether its type changed.
+	Status string `json:"status"`
+
+	// OldPath is the path of the file before the commit, if it was renamed
+	// or copied by the commit.
+	OldPath string `json:"old_path,omitempty"`
+
+	// Path is the path of the file after the commit.
+	Path string `json:"path"`
+
+	// Similarity is the similarity, between 0 and 100, of the file to the
+	// file it was renamed or copied from, if it was.
+	Similarity *uint `json:"similarity,omitempty"`
+}
+
+// FileHistory represents the history of a file: the commits which touched it
+// under its current or earlier names.
+type FileHistory struct {
+	// Files is the list of the files the history is made of: the file asked
+	// for first, then the files it was copied from, if any. Several files
+	// are given when different files had the path asked for.
+	Files []File `json:"files"`
+
+	// Commits is the list of the commits which touched the files, the latest
+	// one first. Only the deltas of the files are kept.
+	Commits []Commit `json:"commits"`
+}
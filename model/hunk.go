@@ -0,0 +1,53 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package model
+
+// Type of a line of a hunk.
+const (
+	LineContext = "context"
+	LineAdded   = "added"
+	LineRemoved = "removed"
+)
+
+// Hunk represents a contiguous block of changes made to a file.
+type Hunk struct {
+	// OldStart is the number of the first line of the hunk in the old file.
+	OldStart int `json:"old_start"`
+
+	// OldLines is the number of lines of the hunk in the old file.
+	OldLines int `json:"old_lines"`
+
+	// NewStart is the number of the first line of the hunk in the new file.
+	NewStart int `json:"new_start"`
+
+	// NewLines is the number of lines of the hunk in the new file.
+	NewLines int `json:"new_lines"`
+
+	// Header is the hunk header, as found in a unified diff
+	// (eg "@@ -97,8 +97,9 @@ func main() {").
+	Header string `json:"header"`
+
+	// Lines is the list of lines of the hunk.
+	Lines []Line `json:"lines"`
+}
+
+// Line represents a line of a hunk.
+type Line struct {
+	// Type tells whether the line is a context line, an added line or a
+	// removed line.
+	Type string `json:"type"`
+
+	// OldLineNo is the number of the line in the old file. It is 0 for added
+	// lines.
+	OldLineNo int `json:"old_line_no,omitempty"`
+
+	// NewLineNo is the number of the line in the new file. It is 0 for
+	// removed lines.
+	NewLineNo int `json:"new_line_no,omitempty"`
+
+	// Content is the content of the line, including the trailing end of
+	// line, if any.
+	Content string `json:"content"`
+}
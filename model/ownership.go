@@ -0,0 +1,46 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package model
+
+// Ownership represents who wrote the lines of the files of a repository at a
+// given commit, as computed by blame.
+type Ownership struct {
+	// Commit is the VCS ID of the commit whose files were blamed.
+	Commit string `json:"commit"`
+
+	// Files is the ownership of each text file, sorted by path.
+	Files []PathOwnership `json:"files"`
+
+	// Directories is the ownership of each directory, aggregated over all
+	// the files it contains, recursively, sorted by path. The root
+	// directory is ".".
+	Directories []PathOwnership `json:"directories"`
+}
+
+// PathOwnership represents the ownership of a file or of a directory.
+type PathOwnership struct {
+	// Path is the path of the file or directory.
+	Path string `json:"path"`
+
+	// Lines is the number of lines of the file or directory.
+	Lines int `json:"lines"`
+
+	// Owners is the list of developers who wrote lines of the file or
+	// directory, the main owner first.
+	Owners []Owner `json:"owners"`
+}
+
+// Owner represents the share of a file or directory written by a developer.
+type Owner struct {
+	// Developer is the canonical identity of the developer.
+	Developer Developer `json:"developer"`
+
+	// Lines is the number of lines written by the developer.
+	Lines int `json:"lines"`
+
+	// Share is the proportion, between 0 and 1, of lines written by the
+	// developer.
+	Share float64 `json:"share"`
+}
@@ -15,15 +15,68 @@ type Repository struct {
 	// CloneURL represents the URL from which the repository was cloned.
 	CloneURL string `json:"clone_url"`
 
+	// Remotes is the list of remotes of the repository. CloneURL is the URL of
+	// one of them.
+	Remotes []Remote `json:"remotes,omitempty"`
+
 	// ClonePath is the absolute path to which the repository was cloned
 	// on the file system.
 	ClonePath string `json:"clone_path"`
 
-	// DefaultBranch is the branch that was active when the repository
-	// information were obtained..
+	// ArchiveGitDir is the location, relative to the archive root, of the git
+	// directory inside the tar archive the repository was read from, if any.
+	// It is "." for a bare repository stored at the archive root.
+	ArchiveGitDir string `json:"archive_git_dir,omitempty"`
+
+	// DefaultBranch is the full name of the branch that was active when the
+	// repository information were obtained (refs/heads/master for instance).
+	// When HEAD is detached, it is the default branch of the remote if known
+	// (refs/remotes/origin/master for instance), the ID of the commit HEAD
+	// points to otherwise.
 	DefaultBranch string `json:"default_branch"`
 
-	// Commits is the list of commits of a repository.
+	// HeadCommit is the ID of the commit HEAD pointed to when the repository
+	// information were obtained. It is empty for repositories without any
+	// commit.
+	HeadCommit string `json:"head_commit"`
+
+	// Anonymization describes how the personal data of the repository were
+	// anonymized, if they were.
+	Anonymization *Anonymization `json:"anonymization,omitempty"`
+
+	// Commits is the list of commits of a repository, in topological order:
+	// every commit comes before its parents.
 	// Note that only the commit of the default branch are retrieved.
 	Commits []Commit `json:"commits"`
+
+	// Tags is the list of tags of a repository, sorted by name.
+	Tags []Tag `json:"tags,omitempty"`
+
+	// Files is the list of files touched by the commits of a repository,
+	// tracked across renames and copies, sorted by path.
+	Files []File `json:"files,omitempty"`
+
+	// Ownership is the ownership of the files of the tree HEAD points to,
+	// when computed.
+	Ownership *Ownership `json:"ownership,omitempty"`
+}
+
+// Remote represents a remote repository that a repository tracks.
+type Remote struct {
+	// Name is the name of the remote (origin, upstream, ...).
+	Name string `json:"name"`
+
+	// URL is the URL of the remote.
+	URL string `json:"url"`
+}
+
+// Anonymization describes how the personal data of a repository were
+// replaced with pseudonyms.
+type Anonymization struct {
+	// Method is the method used to compute pseudonyms (hmac-sha256).
+	Method string `json:"method"`
+
+	// Scrubbed tells whether emails and names of developers were also
+	// scrubbed from commit messages, notes, patches and tag messages.
+	Scrubbed bool `json:"scrubbed"`
 }
@@ -0,0 +1,51 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package model
+
+// Type of a signature.
+const (
+	SignatureGPG  = "gpg"
+	SignatureSSH  = "ssh"
+	SignatureX509 = "x509"
+)
+
+// Verification status of a signature.
+const (
+	// SignatureGood is the status of a valid signature made by a known key.
+	SignatureGood = "good"
+
+	// SignatureBad is the status of a signature which does not match the
+	// signed data or which cannot be parsed.
+	SignatureBad = "bad"
+
+	// SignatureUnknownKey is the status of a signature made by a key which
+	// is not part of the keyring, or the allowed signers, in use, or which is
+	// not allowed to sign for the committer.
+	SignatureUnknownKey = "unknown-key"
+
+	// SignatureUnsupported is the status of a signature which cannot be
+	// verified as its algorithm, or the one of its key, is not supported
+	// (ed25519 OpenPGP keys for instance).
+	SignatureUnsupported = "unsupported"
+)
+
+// Signature represents the cryptographic signature of a commit.
+type Signature struct {
+	// Type is the type of the signature: gpg, ssh or x509.
+	Type string `json:"type"`
+
+	// KeyID identifies the key used to sign. It is the 64 bits key ID, in
+	// hexadecimal, for GPG signatures and the SHA256 fingerprint of the
+	// public key for SSH signatures.
+	KeyID string `json:"key_id,omitempty"`
+
+	// Raw is the signature, as stored in the commit object.
+	Raw string `json:"raw"`
+
+	// Status is the result of the verification of the signature: good, bad,
+	// unknown-key or unsupported. It is empty if the signature was not
+	// verified.
+	Status string `json:"status,omitempty"`
+}
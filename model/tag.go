@@ -0,0 +1,43 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package model
+
+import "time"
+
+// Tag represents a VCS tag.
+type Tag struct {
+	// Name is the name of the tag.
+	Name string `json:"name"`
+
+	// Target is the VCS ID of the commit the tag points to.
+	Target string `json:"target"`
+
+	// Annotated tells whether the tag is an annotated tag or a lightweight
+	// one.
+	Annotated bool `json:"annotated"`
+
+	// Tagger represents the developer that created the tag. It is only
+	// known for annotated tags.
+	Tagger *Developer `json:"tagger,omitempty"`
+
+	// Date represents the date when the tag was created. For lightweight
+	// tags, it is the date when the tagged commit was committed.
+	Date time.Time `json:"date"`
+
+	// Message is the message of annotated tags.
+	Message string `json:"message,omitempty"`
+
+	// Version is the semantic version (MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD])
+	// found in the name of the tag, if any.
+	Version string `json:"version,omitempty"`
+
+	// Release tells whether the tag marks a release, that is whether its
+	// name holds a version which is not a pre-release.
+	Release bool `json:"release"`
+
+	// PreRelease tells whether the tag marks a pre-release, that is whether
+	// its name holds a version with a pre-release part (1.0.0-rc.1).
+	PreRelease bool `json:"prerelease"`
+}
@@ -0,0 +1,577 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/DevMine/repotool/model"
+)
+
+// contentFunc returns the beginning of the content of a file. It is only
+// called when the path of a file is not enough to classify it.
+type contentFunc func() []byte
+
+// classifyContentSize is the maximum number of bytes of a file content looked
+// at when classifying it.
+const classifyContentSize = 8192
+
+// extLanguages maps file extensions to programming languages.
+var extLanguages = map[string]string{
+	".ada":      "Ada",
+	".adb":      "Ada",
+	".ads":      "Ada",
+	".asm":      "Assembly",
+	".s":        "Assembly",
+	".awk":      "Awk",
+	".bat":      "Batchfile",
+	".cmd":      "Batchfile",
+	".c":        "C",
+	".cc":       "C++",
+	".cpp":      "C++",
+	".cxx":      "C++",
+	".c++":      "C++",
+	".hh":       "C++",
+	".hpp":      "C++",
+	".hxx":      "C++",
+	".cs":       "C#",
+	".clj":      "Clojure",
+	".cljs":     "Clojure",
+	".cljc":     "Clojure",
+	".cmake":    "CMake",
+	".coffee":   "CoffeeScript",
+	".css":      "CSS",
+	".d":        "D",
+	".dart":     "Dart",
+	".el":       "Emacs Lisp",
+	".ex":       "Elixir",
+	".exs":      "Elixir",
+	".elm":      "Elm",
+	".erl":      "Erlang",
+	".hrl":      "Erlang",
+	".fs":       "F#",
+	".fsx":      "F#",
+	".f":        "Fortran",
+	".f90":      "Fortran",
+	".f95":      "Fortran",
+	".for":      "Fortran",
+	".go":       "Go",
+	".groovy":   "Groovy",
+	".gradle":   "Groovy",
+	".hs":       "Haskell",
+	".lhs":      "Haskell",
+	".html":     "HTML",
+	".htm":      "HTML",
+	".xhtml":    "HTML",
+	".java":     "Java",
+	".js":       "JavaScript",
+	".jsx":      "JavaScript",
+	".mjs":      "JavaScript",
+	".json":     "JSON",
+	".jl":       "Julia",
+	".kt":       "Kotlin",
+	".kts":      "Kotlin",
+	".less":     "Less",
+	".lisp":     "Common Lisp",
+	".lsp":      "Common Lisp",
+	".lua":      "Lua",
+	".mk":       "Makefile",
+	".md":       "Markdown",
+	".markdown": "Markdown",
+	".ml":       "OCaml",
+	".mli":      "OCaml",
+	".mm":       "Objective-C++",
+	".pas":      "Pascal",
+	".php":      "PHP",
+	".phtml":    "PHP",
+	".pm":       "Perl",
+	".t":        "Perl",
+	".ps1":      "PowerShell",
+	".psm1":     "PowerShell",
+	".proto":    "Protocol Buffer",
+	".py":       "Python",
+	".pyw":      "Python",
+	".pyx":      "Cython",
+	".r":        "R",
+	".rb":       "Ruby",
+	".rake":     "Ruby",
+	".gemspec":  "Ruby",
+	".rs":       "Rust",
+	".rst":      "reStructuredText",
+	".sass":     "Sass",
+	".scss":     "SCSS",
+	".scala":    "Scala",
+	".scm":      "Scheme",
+	".sh":       "Shell",
+	".bash":     "Shell",
+	".zsh":      "Shell",
+	".ksh":      "Shell",
+	".sql":      "SQL",
+	".swift":    "Swift",
+	".tcl":      "Tcl",
+	".tex":      "TeX",
+	".sty":      "TeX",
+	".toml":     "TOML",
+	".ts":       "TypeScript",
+	".tsx":      "TypeScript",
+	".vala":     "Vala",
+	".vb":       "Visual Basic",
+	".vhd":      "VHDL",
+	".vhdl":     "VHDL",
+	".vim":      "Vim script",
+	".vue":      "Vue",
+	".xml":      "XML",
+	".xsd":      "XML",
+	".xsl":      "XSLT",
+	".yml":      "YAML",
+	".yaml":     "YAML",
+	".asciidoc": "AsciiDoc",
+	".adoc":     "AsciiDoc",
+	".txt":      "Text",
+}
+
+// nameLanguages maps file names to programming languages.
+var nameLanguages = map[string]string{
+	"makefile":       "Makefile",
+	"gnumakefile":    "Makefile",
+	"dockerfile":     "Dockerfile",
+	"cmakelists.txt": "CMake",
+	"rakefile":       "Ruby",
+	"gemfile":        "Ruby",
+	"vagrantfile":    "Ruby",
+	"podfile":        "Ruby",
+	"build":          "Starlark",
+	"build.bazel":    "Starlark",
+	"workspace":      "Starlark",
+	"sconstruct":     "Python",
+	"sconscript":     "Python",
+	"meson.build":    "Meson",
+}
+
+// interpreterLanguages maps shebang interpreters to programming languages.
+var interpreterLanguages = map[string]string{
+	"sh":      "Shell",
+	"bash":    "Shell",
+	"zsh":     "Shell",
+	"ksh":     "Shell",
+	"dash":    "Shell",
+	"ash":     "Shell",
+	"python":  "Python",
+	"ruby":    "Ruby",
+	"perl":    "Perl",
+	"node":    "JavaScript",
+	"nodejs":  "JavaScript",
+	"php":     "PHP",
+	"lua":     "Lua",
+	"Rscript": "R",
+	"tclsh":   "Tcl",
+	"wish":    "Tcl",
+	"awk":     "Awk",
+	"gawk":    "Awk",
+	"make":    "Makefile",
+	"escript": "Erlang",
+	"groovy":  "Groovy",
+	"scala":   "Scala",
+	"swift":   "Swift",
+	"julia":   "Julia",
+	"pwsh":    "PowerShell",
+}
+
+// ambiguousExts maps file extensions shared by several languages to a
+// function telling them apart given the file content.
+var ambiguousExts = map[string]func([]byte) string{
+	".h": func(content []byte) string {
+		switch {
+		case objectiveCRe.Match(content):
+			return "Objective-C"
+		case cppRe.Match(content):
+			return "C++"
+		}
+		return "C"
+	},
+	".m": func(content []byte) string {
+		if objectiveCRe.Match(content) {
+			return "Objective-C"
+		}
+		if mathematicaRe.Match(content) {
+			return "Mathematica"
+		}
+		return "MATLAB"
+	},
+	".pl": func(content []byte) string {
+		if prologRe.Match(content) && !perlRe.Match(content) {
+			return "Prolog"
+		}
+		return "Perl"
+	},
+	".v": func(content []byte) string {
+		if verilogRe.Match(content) {
+			return "Verilog"
+		}
+		return "Coq"
+	},
+}
+
+// heuristics used to tell languages sharing file extensions apart
+var (
+	objectiveCRe  = regexp.MustCompile(`(?m)^\s*(@interface|@implementation|@protocol|@end|#import\s)`)
+	cppRe         = regexp.MustCompile(`(?m)^\s*(class\s+\w+\s*[:{]|namespace\s+\w*\s*\{|template\s*<|#include\s*<(iostream|string|vector|map|memory)>|using\s+namespace\s)`)
+	mathematicaRe = regexp.MustCompile(`(?m)^\s*\(\*`)
+	prologRe      = regexp.MustCompile(`(?m):-`)
+	perlRe        = regexp.MustCompile(`(?m)^\s*(use\s+(strict|warnings)|my\s+[$@%]|sub\s+\w+\s*\{)`)
+	verilogRe     = regexp.MustCompile(`(?m)^\s*(module\s+\w+|endmodule|always\s*@)`)
+	generatedRe   = regexp.MustCompile(`(?i)(code generated .* do not edit|@generated|auto-?generated|generated by .* do not (edit|modify))`)
+)
+
+// vendoredDirs is a list of directories typically containing third party
+// code.
+var vendoredDirs = map[string]bool{
+	"vendor":           true,
+	"vendors":          true,
+	"third_party":      true,
+	"third-party":      true,
+	"thirdparty":       true,
+	"external":         true,
+	"extern":           true,
+	"node_modules":     true,
+	"bower_components": true,
+	"jspm_packages":    true,
+	"_workspace":       true, // Godeps/_workspace
+	"site-packages":    true,
+	"Carthage":         true,
+	"Pods":             true,
+	"deps":             true,
+	"__pycache__":      true,
+	".bundle":          true,
+	"dist-packages":    true,
+	"webjars":          true,
+}
+
+// generatedNames is a list of files names of typically generated files.
+var generatedNames = map[string]bool{
+	"package-lock.json":   true,
+	"yarn.lock":           true,
+	"npm-shrinkwrap.json": true,
+	"composer.lock":       true,
+	"gemfile.lock":        true,
+	"cargo.lock":          true,
+	"poetry.lock":         true,
+	"pipfile.lock":        true,
+	"go.sum":              true,
+	"configure":           true,
+	"aclocal.m4":          true,
+}
+
+// generatedSuffixes is a list of file name suffixes of typically generated
+// files.
+var generatedSuffixes = []string{
+	".min.js",
+	".min.css",
+	".js.map",
+	".css.map",
+	".pb.go",
+	".pb.cc",
+	".pb.h",
+	"_pb2.py",
+	".pb.gw.go",
+	"_generated.go",
+	"_string.go",
+	".designer.cs",
+	".g.cs",
+	".generated.cs",
+	"_pb.js",
+}
+
+// docDirs is a list of directories typically containing documentation.
+var docDirs = map[string]bool{
+	"doc":           true,
+	"docs":          true,
+	"documentation": true,
+	"man":           true,
+	"javadoc":       true,
+}
+
+// docNames is a list of names of typically documentation files, without
+// extension. They may be followed by a qualifier (LICENSE-MIT, COPYING.LIB).
+var docNames = []string{
+	"readme",
+	"changelog",
+	"changes",
+	"news",
+	"license",
+	"licence",
+	"copying",
+	"authors",
+	"contributors",
+	"contributing",
+	"history",
+	"install",
+	"notice",
+	"code_of_conduct",
+}
+
+// docLanguages is a list of languages used for documentation.
+var docLanguages = map[string]bool{
+	"Markdown":         true,
+	"reStructuredText": true,
+	"AsciiDoc":         true,
+	"Text":             true,
+	"TeX":              true,
+}
+
+// buildNames is a list of file names of typically build related files.
+var buildNames = map[string]bool{
+	"makefile":          true,
+	"gnumakefile":       true,
+	"cmakelists.txt":    true,
+	"configure.ac":      true,
+	"configure.in":      true,
+	"makefile.am":       true,
+	"makefile.in":       true,
+	"build.gradle":      true,
+	"settings.gradle":   true,
+	"build.xml":         true,
+	"pom.xml":           true,
+	"build.sbt":         true,
+	"package.json":      true,
+	"bower.json":        true,
+	"gruntfile.js":      true,
+	"gulpfile.js":       true,
+	"webpack.config.js": true,
+	"rakefile":          true,
+	"gemfile":           true,
+	"setup.py":          true,
+	"setup.cfg":         true,
+	"requirements.txt":  true,
+	"pipfile":           true,
+	"pyproject.toml":    true,
+	"tox.ini":           true,
+	"cargo.toml":        true,
+	"go.mod":            true,
+	"dockerfile":        true,
+	"vagrantfile":       true,
+	"build":             true,
+	"build.bazel":       true,
+	"workspace":         true,
+	"sconstruct":        true,
+	"meson.build":       true,
+	".travis.yml":       true,
+	"appveyor.yml":      true,
+	".gitlab-ci.yml":    true,
+	"jenkinsfile":       true,
+	"composer.json":     true,
+}
+
+// buildExts is a list of file extensions of typically build related files.
+var buildExts = map[string]bool{
+	".mk":      true,
+	".cmake":   true,
+	".gradle":  true,
+	".csproj":  true,
+	".vcxproj": true,
+	".sln":     true,
+	".pro":     true,
+	".pri":     true,
+	".bzl":     true,
+	".nix":     true,
+}
+
+// buildDirs is a list of directories typically containing build related
+// files.
+var buildDirs = map[string]bool{
+	".circleci":     true,
+	".buildkite":    true,
+	"debian":        true,
+	"rpm":           true,
+	"buildscripts":  true,
+	"build-support": true,
+}
+
+// testDirs is a list of directories typically containing tests.
+var testDirs = map[string]bool{
+	"test":      true,
+	"tests":     true,
+	"testing":   true,
+	"testdata":  true,
+	"__tests__": true,
+	"spec":      true,
+	"specs":     true,
+	"t":         true,
+}
+
+// testNameRe matches file names of typical test files.
+// Test and Tests are matched as whole words of CamelCase names, so that
+// Latest.java or Contest.java are not taken for tests.
+var testNameRe = regexp.MustCompile(`(?i)(_test\.go|^test_.*\.py|_test\.py|_spec\.rb|_test\.rb|^(?-i:Tests?([A-Z0-9_].*)?)\.(java|kt|scala|cs|swift)|(?-i:Tests?)\.(java|kt|scala|cs|swift)|\.(test|spec)\.(js|jsx|ts|tsx|mjs)|_test\.(c|cc|cpp|rs|exs))$`)
+
+// classifyFile returns the language and the category of the file at path p.
+// The language is empty if unknown.
+func classifyFile(p string, binary bool, content contentFunc) (string, string) {
+	language := detectLanguage(p, content)
+	return language, detectCategory(p, language, binary, content)
+}
+
+// detectLanguage returns the programming language of the file at path p, or
+// an empty string if unknown. The file extension is looked at first, then
+// the file name and, for ambiguous extensions and files without known
+// extension, the file content (shebang and heuristics).
+func detectLanguage(p string, content contentFunc) string {
+	name := path.Base(p)
+	ext := strings.ToLower(path.Ext(name))
+
+	if fn, ok := ambiguousExts[ext]; ok {
+		return fn(content())
+	}
+	if language, ok := nameLanguages[strings.ToLower(name)]; ok {
+		return language
+	}
+	if language, ok := extLanguages[ext]; ok {
+		return language
+	}
+
+	return shebangLanguage(content())
+}
+
+// shebangLanguage returns the language of a script given its content, based
+// on its shebang (eg #!/usr/bin/env python), or an empty string.
+func shebangLanguage(content []byte) string {
+	if !bytes.HasPrefix(content, []byte("#!")) {
+		return ""
+	}
+
+	line := content[2:]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		// skip env options such as -S
+		fields = fields[1:]
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			return ""
+		}
+		interpreter = path.Base(fields[0])
+	}
+
+	// strip version numbers (python2.7, ruby1.9, ...)
+	interpreter = strings.TrimRight(interpreter, "0123456789.")
+
+	return interpreterLanguages[interpreter]
+}
+
+// detectCategory returns the category of the file at path p. Categories are
+// checked in the following order, based on the path of the file: vendored,
+// generated, binary, test, build names and extensions, documentation and
+// build directories. Build names come before documentation as some of them
+// have the extension of a documentation language (requirements.txt). Only
+// then is the content
+// of the file looked at, for a generated code marker. Files not belonging to
+// any of those are source files if their language is known.
+func detectCategory(p, language string, binary bool, content contentFunc) string {
+	name := path.Base(p)
+	lowerName := strings.ToLower(name)
+	ext := strings.ToLower(path.Ext(name))
+	dirs := strings.Split(path.Dir(p), "/")
+
+	for _, dir := range dirs {
+		if vendoredDirs[dir] {
+			return model.CategoryVendored
+		}
+	}
+
+	if generatedNames[lowerName] {
+		return model.CategoryGenerated
+	}
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(lowerName, suffix) {
+			return model.CategoryGenerated
+		}
+	}
+
+	if binary {
+		return model.CategoryBinary
+	}
+
+	if testNameRe.MatchString(name) {
+		return model.CategoryTest
+	}
+	for _, dir := range dirs {
+		if testDirs[strings.ToLower(dir)] {
+			return model.CategoryTest
+		}
+	}
+
+	if buildNames[lowerName] || buildExts[ext] {
+		return model.CategoryBuild
+	}
+
+	if docLanguages[language] {
+		return model.CategoryDocumentation
+	}
+	// install.go or news_controller.rb are not documentation
+	if len(language) == 0 && isDocName(strings.TrimSuffix(lowerName, ext)) {
+		return model.CategoryDocumentation
+	}
+	for _, dir := range dirs {
+		if docDirs[strings.ToLower(dir)] {
+			return model.CategoryDocumentation
+		}
+	}
+
+	for _, dir := range dirs {
+		if buildDirs[strings.ToLower(dir)] {
+			return model.CategoryBuild
+		}
+	}
+
+	if generatedRe.Match(firstLines(content(), 5)) {
+		return model.CategoryGenerated
+	}
+
+	if len(language) > 0 {
+		return model.CategorySource
+	}
+	return model.CategoryOther
+}
+
+// isDocName returns true if the stem of a lowercased file name, ie the name
+// without its extension, is the one of a typically documentation file,
+// possibly followed by a qualifier (license-mit).
+func isDocName(stem string) bool {
+	for _, name := range docNames {
+		if stem == name {
+			return true
+		}
+		if strings.HasPrefix(stem, name) && strings.IndexByte("-_.", stem[len(name)]) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// firstLines returns the first n lines of content.
+func firstLines(content []byte, n int) []byte {
+	end := 0
+	for i := 0; i < n; i++ {
+		j := bytes.IndexByte(content[end:], '\n')
+		if j < 0 {
+			return content
+		}
+		end += j + 1
+	}
+	return content[:end]
+}
@@ -0,0 +1,170 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"testing"
+
+	"github.com/DevMine/repotool/model"
+)
+
+func TestShebangLanguage(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"", ""},
+		{"echo hello\n", ""},
+		{"#!/bin/sh\necho hello\n", "Shell"},
+		{"#!/bin/bash -e\n", "Shell"},
+		{"#!/usr/bin/env python\n", "Python"},
+		{"#!/usr/bin/env python3\n", "Python"},
+		{"#!/usr/bin/python2.7", "Python"},
+		{"#!/usr/bin/env -S node --harmony\n", "JavaScript"},
+		{"#! /usr/bin/perl -w\n", "Perl"},
+		{"#!/usr/bin/env\n", ""},
+		{"#!\n", ""},
+		{"#!/usr/bin/unknown\n", ""},
+	}
+
+	for _, tt := range tests {
+		if got := shebangLanguage([]byte(tt.content)); got != tt.want {
+			t.Errorf("shebangLanguage(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		path    string
+		content string
+		want    string
+	}{
+		{"main.go", "", "Go"},
+		{"src/Foo.JAVA", "", "Java"},
+		{"Makefile", "", "Makefile"},
+		{"CMakeLists.txt", "", "CMake"},
+		{"foo.h", "int f(void);\n", "C"},
+		{"foo.h", "namespace foo {\n}\n", "C++"},
+		{"foo.h", "@interface Foo\n@end\n", "Objective-C"},
+		{"foo.m", "function y = f(x)\n", "MATLAB"},
+		{"foo.pl", "use strict;\nmy $a = 1;\n", "Perl"},
+		{"foo.pl", "likes(X, Y) :- friend(X, Y).\n", "Prolog"},
+		{"bin/script", "#!/usr/bin/env ruby\n", "Ruby"},
+		{"bin/script", "", ""},
+	}
+
+	for _, tt := range tests {
+		got := detectLanguage(tt.path, func() []byte { return []byte(tt.content) })
+		if got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDetectCategory(t *testing.T) {
+	tests := []struct {
+		path    string
+		binary  bool
+		content string
+		want    string
+	}{
+		{"main.go", false, "", model.CategorySource},
+		{"vendor/github.com/foo/bar.go", false, "", model.CategoryVendored},
+		{"web/node_modules/x/index.js", false, "", model.CategoryVendored},
+		{"package-lock.json", false, "", model.CategoryGenerated},
+		{"static/app.min.js", false, "", model.CategoryGenerated},
+		{"api/api.pb.go", false, "", model.CategoryGenerated},
+		{"gen.go", false, "// Code generated by stringer. DO NOT EDIT.\n", model.CategoryGenerated},
+		{"logo.png", true, "", model.CategoryBinary},
+		{"repo/git_test.go", false, "", model.CategoryTest},
+		{"test_utils.py", false, "", model.CategoryTest},
+		{"src/FooTest.java", false, "", model.CategoryTest},
+		{"src/FooTests.cs", false, "", model.CategoryTest},
+		{"src/TestFoo.java", false, "", model.CategoryTest},
+		{"src/Test.java", false, "", model.CategoryTest},
+		{"src/Latest.java", false, "", model.CategorySource},
+		{"src/Contest.java", false, "", model.CategorySource},
+		{"src/Testimonial.java", false, "", model.CategorySource},
+		{"app.spec.ts", false, "", model.CategoryTest},
+		{"tests/helpers.rb", false, "", model.CategoryTest},
+		{"README.md", false, "", model.CategoryDocumentation},
+		{"README", false, "", model.CategoryDocumentation},
+		{"LICENSE", false, "", model.CategoryDocumentation},
+		{"LICENSE-MIT", false, "", model.CategoryDocumentation},
+		{"COPYING.LIB", false, "", model.CategoryDocumentation},
+		{"CHANGES", false, "", model.CategoryDocumentation},
+		{"docs/conf.py", false, "", model.CategoryDocumentation},
+		{"install.go", false, "", model.CategorySource},
+		{"history.py", false, "", model.CategorySource},
+		{"changes.rb", false, "", model.CategorySource},
+		{"app/controllers/news_controller.rb", false, "", model.CategorySource},
+		{"authors.go", false, "", model.CategorySource},
+		{"license_check.go", false, "", model.CategorySource},
+		{"licenses", false, "", model.CategoryOther},
+		{"Makefile", false, "", model.CategoryBuild},
+		{"requirements.txt", false, "", model.CategoryBuild},
+		{"docs/requirements.txt", false, "", model.CategoryBuild},
+		{"notes.txt", false, "", model.CategoryDocumentation},
+		{"cmake/deps.cmake", false, "", model.CategoryBuild},
+		{"debian/rules", false, "", model.CategoryBuild},
+		{"data.bin", false, "", model.CategoryOther},
+	}
+
+	for _, tt := range tests {
+		content := func() []byte { return []byte(tt.content) }
+		language := detectLanguage(tt.path, content)
+		if got := detectCategory(tt.path, language, tt.binary, content); got != tt.want {
+			t.Errorf("detectCategory(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDetectCategoryReadsContentLast(t *testing.T) {
+	tests := []struct {
+		path     string
+		language string
+		binary   bool
+		read     bool
+	}{
+		{"vendor/foo.go", "Go", false, false},
+		{"foo.min.js", "JavaScript", false, false},
+		{"logo.png", "", true, false},
+		{"foo_test.go", "Go", false, false},
+		{"README.md", "Markdown", false, false},
+		{"Makefile", "Makefile", false, false},
+		{"main.go", "Go", false, true},
+	}
+
+	for _, tt := range tests {
+		var read bool
+		detectCategory(tt.path, tt.language, tt.binary, func() []byte {
+			read = true
+			return nil
+		})
+		if read != tt.read {
+			t.Errorf("%s: content read: %v, want %v", tt.path, read, tt.read)
+		}
+	}
+}
+
+func TestFirstLines(t *testing.T) {
+	tests := []struct {
+		content string
+		n       int
+		want    string
+	}{
+		{"", 5, ""},
+		{"a\nb\nc\n", 2, "a\nb\n"},
+		{"a\nb\nc", 5, "a\nb\nc"},
+		{"a\nb\n", 0, ""},
+	}
+
+	for _, tt := range tests {
+		if got := string(firstLines([]byte(tt.content), tt.n)); got != tt.want {
+			t.Errorf("firstLines(%q, %d) = %q, want %q", tt.content, tt.n, got, tt.want)
+		}
+	}
+}
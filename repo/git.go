@@ -8,43 +8,124 @@ import (
 	"archive/tar"
 	"errors"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/golang/glog"
 	g2g "github.com/libgit2/git2go"
 
+	"github.com/DevMine/repotool/anonymize"
 	"github.com/DevMine/repotool/config"
 	"github.com/DevMine/repotool/model"
 )
 
+// defaultRemote is the remote whose URL is used as clone URL when none is
+// specified.
+const defaultRemote = "origin"
+
 // gitRepo is a repository with some things specific to git.
 type gitRepo struct {
 	model.Repository
-	cfg    config.DataConfig
-	r      *g2g.Repository
-	tmpDir string
+	cfg        config.DataConfig
+	r          *g2g.Repository
+	odb        *g2g.Odb
+	verifier   *signatureVerifier
+	mailmap    mailmap
+	anonymizer *anonymize.Anonymizer
+	lineage    *lineage
+	objects    *tarObjects
+	tmpDir     string
 }
 
-// New creates a new gitRepo object.
-func newGitRepo(cfg config.DataConfig, repository model.Repository, gitDir string, useTmpDir bool) (*gitRepo, error) {
-	r, err := g2g.OpenRepository(gitDir)
+// New creates a new gitRepo object. repoPath may either be the path to the
+// working directory of a repository, with a .git directory or a .git file
+// pointing to the actual git directory, or the path to a git directory, as is
+// the case for bare repositories.
+// The remotes, default branch and HEAD of the repository are read through
+// libgit2 from the git directory it resolves.
+// When objects is not nil, the objects of the repository are read from it
+// first, and it is closed by Cleanup.
+func newGitRepo(cfg config.DataConfig, repository model.Repository, repoPath string, useTmpDir bool, objects *tarObjects) (*gitRepo, error) {
+	r, err := g2g.OpenRepository(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	odb, err := r.Odb()
+	if err != nil {
+		r.Free()
+		return nil, err
+	}
+
+	if objects != nil {
+		if err = addTarObjectsBackend(odb, objects); err != nil {
+			odb.Free()
+			r.Free()
+			return nil, err
+		}
+	}
+
+	remotes, err := extractGitRemotes(r)
+	if err != nil {
+		odb.Free()
+		r.Free()
+		return nil, err
+	}
+	repository.Remotes = remotes
+
+	cloneURL, err := extractGitURL(remotes, cfg.Remote)
+	if err != nil {
+		odb.Free()
+		r.Free()
+		return nil, err
+	}
+	repository.CloneURL = *cloneURL
+
+	branch, headCommit, err := extractGitHead(r, cfg.Remote)
 	if err != nil {
+		odb.Free()
+		r.Free()
 		return nil, err
 	}
+	repository.DefaultBranch = branch
+	repository.HeadCommit = headCommit
+
+	verifier, err := newSignatureVerifier(cfg)
+	if err != nil {
+		odb.Free()
+		r.Free()
+		return nil, err
+	}
+
+	mm, err := readGitMailmap(r, cfg.MailmapFile)
+	if err != nil {
+		odb.Free()
+		r.Free()
+		return nil, err
+	}
+
+	var anonymizer *anonymize.Anonymizer
+	if len(cfg.AnonymizationKey) > 0 {
+		anonymizer = anonymize.New(cfg.AnonymizationKey, cfg.ScrubPersonalData)
+		repository.Anonymization = anonymizer.Metadata()
+		anonymizer.Repository(&repository)
+	}
 
 	var tmpDir string
 	if useTmpDir {
-		tmpDir = gitDir
+		tmpDir = repoPath
 	}
 
-	return &gitRepo{Repository: repository, cfg: cfg, r: r, tmpDir: tmpDir}, nil
+	return &gitRepo{Repository: repository, cfg: cfg, r: r, odb: odb, verifier: verifier, mailmap: mm, anonymizer: anonymizer, objects: objects, tmpDir: tmpDir}, nil
 }
 
 // FetchCommits fetches all commits from a Git repository and adds them to
-// the list of commits of the repository object.
+// the list of commits of the repository object, in topological order: every
+// commit comes before its parents.
 func (gr *gitRepo) FetchCommits() error {
 	gr.Commits = make([]model.Commit, 0) // give number of commits
 
@@ -53,19 +134,129 @@ func (gr *gitRepo) FetchCommits() error {
 		return err
 	}
 
-	err = rw.PushHead()
-	if err != nil {
-		return err
+	// the lineage index, and analyses following renames, need commits to be
+	// given before their parents
+	rw.Sorting(g2g.SortTopological | g2g.SortTime)
+	if gr.cfg.FileLineage {
+		gr.lineage = newLineage()
 	}
 
-	err = rw.Iterate(gr.addCommit)
+	// an empty repository has no commit to walk from
+	if len(gr.HeadCommit) > 0 {
+		if err = rw.PushHead(); err != nil {
+			return err
+		}
+		if err = rw.Iterate(gr.addCommit); err != nil {
+			return err
+		}
+	}
+
+	if gr.lineage != nil {
+		gr.Files = gr.lineage.modelFiles()
+	}
+
+	if gr.anonymizer != nil {
+		gr.anonymizer.Commits(gr.Commits)
+	}
+
+	return nil
+}
+
+// FetchTags fetches all tags from a Git repository, lightweight and
+// annotated ones, and adds them to the list of tags of the repository object.
+// Tags which do not point to a commit are ignored.
+func (gr *gitRepo) FetchTags() error {
+	gr.Tags = make([]model.Tag, 0)
+
+	it, err := gr.r.NewReferenceIteratorGlob("refs/tags/*")
 	if err != nil {
 		return err
 	}
+	defer it.Free()
+
+	for {
+		ref, err := it.Next()
+		if g2g.IsErrorCode(err, g2g.ErrIterOver) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		tag, err := gr.gitTag(ref)
+		ref.Free()
+		if err != nil {
+			return err
+		}
+		if tag != nil {
+			gr.Tags = append(gr.Tags, *tag)
+		}
+	}
+	sort.Sort(tagsByName(gr.Tags))
+
+	if gr.anonymizer != nil {
+		gr.anonymizer.Tags(gr.Tags)
+	}
 
 	return nil
 }
 
+// gitTag returns the tag a reference stands for, or nil if it does not point
+// to a commit.
+func (gr *gitRepo) gitTag(ref *g2g.Reference) (*model.Tag, error) {
+	// tags of trees or blobs cannot be peeled to a commit
+	obj, err := ref.Peel(g2g.ObjectCommit)
+	if err != nil {
+		return nil, nil
+	}
+	defer obj.Free()
+
+	tag := &model.Tag{
+		Name:   strings.TrimPrefix(ref.Name(), "refs/tags/"),
+		Target: obj.Id().String(),
+	}
+	if version, prerelease, ok := parseVersion(tag.Name); ok {
+		tag.Version = version
+		tag.PreRelease = prerelease
+		tag.Release = !prerelease
+	}
+
+	if oid := ref.Target(); oid != nil {
+		tagObj, err := gr.r.Lookup(oid)
+		if err != nil {
+			return nil, err
+		}
+		defer tagObj.Free()
+
+		if t, ok := tagObj.(*g2g.Tag); ok {
+			tag.Annotated = true
+			tag.Message = t.Message()
+			if tagger := t.Tagger(); tagger != nil {
+				dev := gr.mailmap.developer(tagger.Name, tagger.Email)
+				tag.Tagger = &dev
+				tag.Date = tagger.When
+				return tag, nil
+			}
+		}
+	}
+
+	c, err := gr.r.LookupCommit(obj.Id())
+	if err != nil {
+		return nil, err
+	}
+	defer c.Free()
+	tag.Date = c.Committer().When
+
+	return tag, nil
+}
+
+// tagsByName implements sort.Interface to sort tags by name.
+type tagsByName []model.Tag
+
+func (t tagsByName) Len() int           { return len(t) }
+func (t tagsByName) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t tagsByName) Less(i, j int) bool { return t[i].Name < t[j].Name }
+
 // GetRepository returns the repository structre contained in a git repository.
 func (gr gitRepo) GetRepository() *model.Repository {
 	return &gr.Repository
@@ -86,6 +277,11 @@ func (gr gitRepo) GetCloneURL() string {
 	return gr.CloneURL
 }
 
+// GetRemotes returns the remotes of a git repository.
+func (gr gitRepo) GetRemotes() []model.Remote {
+	return gr.Remotes
+}
+
 // GetClonePath returns the clone path of a git repository.
 func (gr gitRepo) GetClonePath() string {
 	return gr.ClonePath
@@ -96,6 +292,12 @@ func (gr gitRepo) GetDefaultBranch() string {
 	return gr.DefaultBranch
 }
 
+// GetHeadCommit returns the ID of the commit HEAD of the git repository
+// points to.
+func (gr gitRepo) GetHeadCommit() string {
+	return gr.HeadCommit
+}
+
 // GetCommits returns the list of commits in the git repository.
 // If the list is empty of nil, this probably means that a call to
 // FetchCommits() is needed to populate the list.
@@ -103,12 +305,50 @@ func (gr gitRepo) GetCommits() []model.Commit {
 	return gr.Commits
 }
 
+// GetTags returns the list of tags in the git repository.
+// If the list is empty of nil, this probably means that a call to
+// FetchTags() is needed to populate the list.
+func (gr gitRepo) GetTags() []model.Tag {
+	return gr.Tags
+}
+
+// GetFiles returns the list of files touched by the commits of the git
+// repository. If the list is empty or nil, this probably means that a call to
+// FetchCommits() with file lineage enabled is needed.
+func (gr gitRepo) GetFiles() []model.File {
+	return gr.Files
+}
+
+// GetFileHistory returns the history of the file found at path in the git
+// repository, or of the files which were found there at some point. Files
+// are only known after a call to FetchCommits() with file lineage enabled.
+func (gr gitRepo) GetFileHistory(path string) *model.FileHistory {
+	return fileHistory(gr.Files, gr.Commits, path)
+}
+
+// GetOwnership returns the ownership of the files of the git repository.
+// If nil, this probably means that a call to FetchOwnership() is needed.
+func (gr gitRepo) GetOwnership() *model.Ownership {
+	return gr.Ownership
+}
+
 // Cleanup frees open repositories and removes temporary created files, if any.
 func (gr gitRepo) Cleanup() error {
+	if gr.odb != nil {
+		gr.odb.Free()
+	}
 	if gr.r != nil {
 		gr.r.Free()
 	}
 
+	// the object database, hence its backends, are freed along with the
+	// repository
+	if gr.objects != nil {
+		if err := gr.objects.Close(); err != nil {
+			return err
+		}
+	}
+
 	if len(gr.tmpDir) > 0 {
 		return os.RemoveAll(gr.tmpDir)
 	}
@@ -124,7 +364,7 @@ var deltaMap = map[g2g.Delta]*string{
 	g2g.DeltaCopied:     &model.StatusCopied,
 	g2g.DeltaIgnored:    nil,
 	g2g.DeltaUntracked:  nil,
-	g2g.DeltaTypeChange: nil,
+	g2g.DeltaTypeChange: &model.StatusTypeChange,
 }
 
 // addCommit is conform to the g2g.RevWalIterator type in order to be used
@@ -143,19 +383,34 @@ func (gr *gitRepo) addCommit(c *g2g.Commit) bool {
 	commit.VCSID = oID.String()
 
 	commit.Message = c.Message()
+	commit.Subject, commit.Body = splitMessage(commit.Message)
+	commit.IssueRefs = parseIssueRefs(commit.Message)
+	commit.Trailers = parseTrailers(commit.Message)
+	commit.CoAuthors = coAuthors(commit.Trailers)
+	for i, d := range commit.CoAuthors {
+		commit.CoAuthors[i] = gr.mailmap.developer(d.Name, d.Email)
+	}
 
-	var author model.Developer
-	author.Name = c.Author().Name
-	author.Email = c.Author().Email
-	commit.Author = author
-
-	var committer model.Developer
-	committer.Name = c.Committer().Name
-	committer.Email = c.Committer().Email
-	commit.Committer = committer
+	commit.Author = gr.mailmap.developer(c.Author().Name, c.Author().Email)
+	commit.Committer = gr.mailmap.developer(c.Committer().Name, c.Committer().Email)
 
 	commit.CommitDate = c.Committer().When
 	commit.AuthorDate = c.Author().When
+	commit.CommitterTZOffset = tzOffset(commit.CommitDate)
+	commit.AuthorTZOffset = tzOffset(commit.AuthorDate)
+
+	// a signature which cannot be read must not end the walk: the commit is
+	// reported without it
+	if signature, err := gr.commitSignature(oID, c.Committer().Email); err == nil {
+		commit.Signature = signature
+	}
+
+	// neither must notes which cannot be read
+	notes, err := gr.commitNotes(oID)
+	if err != nil {
+		glog.Warningf("cannot read the notes of commit %s: %v", oID, err)
+	}
+	commit.Notes = notes
 
 	parentC := c.Parent(0)
 	if parentC == nil {
@@ -172,7 +427,7 @@ func (gr *gitRepo) addCommit(c *g2g.Commit) bool {
 		return false
 	}
 
-	diffOpts, err := g2g.DefaultDiffOptions()
+	diffOpts, err := gr.diffOptions()
 	if err != nil {
 		return false
 	}
@@ -182,125 +437,547 @@ func (gr *gitRepo) addCommit(c *g2g.Commit) bool {
 		return false
 	}
 
+	findOpts, err := gr.diffFindOptions()
+	if err != nil {
+		return false
+	}
+
+	if err = diff.FindSimilar(&findOpts); err != nil {
+		return false
+	}
+
 	stats, err := diff.Stats()
 	if err != nil {
 		return false
 	}
 
 	if gr.cfg.CommitDeltas {
-		nDeltas, err := diff.NumDeltas()
+		commit.DiffDelta, err = gr.diffDeltas(diff)
 		if err != nil {
 			return false
 		}
+		commit.Languages = languageBreakdown(commit.DiffDelta)
+	}
 
-		for d := 0; d < nDeltas; d++ {
-			var cdd model.DiffDelta
+	commit.FileChangedCount = stats.FilesChanged()
+	commit.InsertionsCount = stats.Insertions()
+	commit.DeletionsCount = stats.Deletions()
 
-			if gr.cfg.CommitPatches {
-				patch, err := diff.Patch(d)
-				if err != nil || patch == nil {
-					return false
-				}
-				p, err := patch.String()
-				if err != nil {
-					return false
-				}
-				cdd.Patch = &p
-			}
+	if ok := isCommitValid(commit); !ok {
+		return false
+	}
+	if gr.lineage != nil {
+		gr.lineage.add(commit)
+	}
+	gr.Commits = append(gr.Commits, commit)
+
+	return true
+}
+
+// commitNotes returns the notes attached to the commit whose ID is oid,
+// mapped by notes reference, or nil if it has none.
+func (gr *gitRepo) commitNotes(oid *g2g.Oid) (map[string]string, error) {
+	var notes map[string]string
+	for _, name := range gr.cfg.NotesRefs {
+		ref := notesRef(name)
+		note, err := gr.r.ReadNote(ref, oid)
+		if g2g.IsErrorCode(err, g2g.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if notes == nil {
+			notes = make(map[string]string)
+		}
+		notes[ref] = note.Message()
+		note.Free()
+	}
+	return notes, nil
+}
+
+// notesRef returns the full name of a notes reference. As git does, names
+// not starting with refs/notes/ are looked up under this prefix.
+func notesRef(name string) string {
+	if strings.HasPrefix(name, "refs/notes/") {
+		return name
+	}
+	return "refs/notes/" + strings.TrimPrefix(name, "notes/")
+}
 
-			diffDelta, err := diff.GetDelta(d)
+// diffDeltas returns the list of deltas of a diff, along with their line
+// statistics and, if requested, their patch and hunks.
+// Unless hunks are requested, line statistics are computed from the patch of
+// each delta: having libgit2 call back for every line is much slower.
+func (gr *gitRepo) diffDeltas(diff *g2g.Diff) ([]model.DiffDelta, error) {
+	var deltas []model.DiffDelta
+	var index int
+
+	fileCb := func(diffDelta g2g.DiffDelta, _ float64) (g2g.DiffForEachHunkCallback, error) {
+		index++
+		// skip unmodified files and the like
+		if deltaMap[diffDelta.Status] == nil {
+			return nil, nil
+		}
+
+		var cdd model.DiffDelta
+
+		var p string
+		if gr.cfg.CommitPatches || !gr.cfg.CommitHunks {
+			patch, err := diff.Patch(index - 1)
 			if err != nil {
-				return false
+				return nil, err
 			}
-			cdd.Status = deltaMap[diffDelta.Status]
+			if patch == nil {
+				return nil, errors.New("cannot compute patch")
+			}
+			p, err = patch.String()
+			patch.Free()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if gr.cfg.CommitPatches {
+			cdd.Patch = &p
+		}
+
+		cdd.Status = deltaMap[diffDelta.Status]
+
+		var isBin bool
+		if (diffDelta.Flags & g2g.DiffFlagBinary) > 0 {
+			isBin = true
+		}
+		cdd.Binary = &isBin
+
+		if diffDelta.Status == g2g.DeltaRenamed || diffDelta.Status == g2g.DeltaCopied {
+			similarity := uint(diffDelta.Similarity)
+			cdd.Similarity = &similarity
+		}
+
+		cdd.OldFilePath = &diffDelta.OldFile.Path
+		cdd.NewFilePath = &diffDelta.NewFile.Path
 
-			var isBin bool
-			if (diffDelta.Flags & g2g.DiffFlagBinary) > 0 {
-				isBin = true
+		cdd.OldFileMode = fileMode(diffDelta.OldFile)
+		cdd.NewFileMode = fileMode(diffDelta.NewFile)
+		cdd.OldBlobID = blobID(diffDelta.OldFile)
+		cdd.NewBlobID = blobID(diffDelta.NewFile)
+
+		isSubmodule := g2g.Filemode(diffDelta.OldFile.Mode) == g2g.FilemodeCommit ||
+			g2g.Filemode(diffDelta.NewFile.Mode) == g2g.FilemodeCommit
+		cdd.Submodule = &isSubmodule
+
+		// deleted files are classified according to their last version
+		file := diffDelta.NewFile
+		if diffDelta.Status == g2g.DeltaDeleted {
+			file = diffDelta.OldFile
+		}
+		var content []byte
+		var loaded bool
+		language, category := classifyFile(file.Path, isBin, func() []byte {
+			if !loaded {
+				content = gr.blobContent(file.Oid, classifyContentSize)
+				loaded = true
+			}
+			return content
+		})
+		if len(language) > 0 {
+			cdd.Language = &language
+		}
+		cdd.Category = &category
+
+		if !gr.cfg.CommitHunks {
+			insertions, deletions, hunks := patchStats(p)
+			cdd.Insertions = &insertions
+			cdd.Deletions = &deletions
+			cdd.Hunks = &hunks
+
+			deltas = append(deltas, cdd)
+			return nil, nil
+		}
+
+		// line statistics are filled while iterating over hunks and lines
+		var insertions, deletions, hunks int
+		cdd.Insertions = &insertions
+		cdd.Deletions = &deletions
+		cdd.Hunks = &hunks
+
+		deltas = append(deltas, cdd)
+
+		d := len(deltas) - 1
+		return func(hunk g2g.DiffHunk) (g2g.DiffForEachLineCallback, error) {
+			hunks++
+
+			var h *model.Hunk
+			if gr.cfg.CommitHunks {
+				deltas[d].DiffHunks = append(deltas[d].DiffHunks, model.Hunk{
+					OldStart: hunk.OldStart,
+					OldLines: hunk.OldLines,
+					NewStart: hunk.NewStart,
+					NewLines: hunk.NewLines,
+					Header:   hunk.Header,
+				})
+				h = &deltas[d].DiffHunks[len(deltas[d].DiffHunks)-1]
 			}
-			cdd.Binary = &isBin
 
-			// TODO compute similarity to add to cdd.Similarity
+			return func(line g2g.DiffLine) error {
+				var lineType string
+				switch line.Origin {
+				case g2g.DiffLineAddition:
+					insertions++
+					lineType = model.LineAdded
+				case g2g.DiffLineDeletion:
+					deletions++
+					lineType = model.LineRemoved
+				case g2g.DiffLineContext:
+					lineType = model.LineContext
+				default:
+					// end of file markers and the like
+					return nil
+				}
+
+				if h != nil {
+					h.Lines = append(h.Lines, model.Line{
+						Type:      lineType,
+						OldLineNo: lineNumber(line.OldLineno),
+						NewLineNo: lineNumber(line.NewLineno),
+						Content:   line.Content,
+					})
+				}
+				return nil
+			}, nil
+		}, nil
+	}
+
+	detail := g2g.DiffDetailFiles
+	if gr.cfg.CommitHunks {
+		detail = g2g.DiffDetailLines
+	}
+	if err := diff.ForEach(fileCb, detail); err != nil {
+		return nil, err
+	}
 
-			cdd.OldFilePath = &diffDelta.OldFile.Path
-			cdd.NewFilePath = &diffDelta.NewFile.Path
+	return deltas, nil
+}
 
-			commit.DiffDelta = append(commit.DiffDelta, cdd)
+// patchStats returns the number of inserted and deleted lines and the number
+// of hunks of a patch in the unified format.
+func patchStats(patch string) (insertions, deletions, hunks int) {
+	for len(patch) > 0 {
+		line := patch
+		if i := strings.IndexByte(patch, '\n'); i >= 0 {
+			line, patch = patch[:i], patch[i+1:]
+		} else {
+			patch = ""
+		}
+
+		switch {
+		case strings.HasPrefix(line, "@@ "):
+			hunks++
+		case hunks == 0:
+			// file header, whose ---/+++ lines are not changes
+		case strings.HasPrefix(line, "+"):
+			insertions++
+		case strings.HasPrefix(line, "-"):
+			deletions++
 		}
 	}
+	return insertions, deletions, hunks
+}
 
-	commit.FileChangedCount = stats.FilesChanged()
-	commit.InsertionsCount = stats.Insertions()
-	commit.DeletionsCount = stats.Deletions()
+// blobContent returns at most the first max bytes of the content of a blob.
+// It returns nil if the blob cannot be read, as is the case for submodules.
+func (gr *gitRepo) blobContent(oid *g2g.Oid, max int) []byte {
+	if oid == nil || oid.IsZero() {
+		return nil
+	}
 
-	if ok := isCommitValid(commit); !ok {
-		return false
+	blob, err := gr.r.LookupBlob(oid)
+	if err != nil {
+		return nil
 	}
-	gr.Commits = append(gr.Commits, commit)
+	defer blob.Free()
 
-	return true
+	content := blob.Contents()
+	if len(content) > max {
+		content = content[:max]
+	}
+
+	// the content belongs to libgit2 and is not valid once the blob freed
+	return append([]byte(nil), content...)
 }
 
-// extractGitURL returns a git repository clone URL as a string, given the
-// path to its location on disk.
-func extractGitURL(path string) (*string, error) {
-	f, err := os.Open(filepath.Join(path, ".git", "config"))
+// languageBreakdown breaks the changes described by deltas down by
+// programming language.
+func languageBreakdown(deltas []model.DiffDelta) map[string]model.LanguageStats {
+	languages := map[string]model.LanguageStats{}
+	for _, d := range deltas {
+		if d.Language == nil {
+			continue
+		}
+
+		stats := languages[*d.Language]
+		stats.FileChangedCount++
+		if d.Insertions != nil {
+			stats.InsertionsCount += *d.Insertions
+		}
+		if d.Deletions != nil {
+			stats.DeletionsCount += *d.Deletions
+		}
+		languages[*d.Language] = stats
+	}
+
+	if len(languages) == 0 {
+		return nil
+	}
+	return languages
+}
+
+// fileMode returns the mode of a diff file in octal notation, or nil if the
+// file does not exist on its side of the diff.
+func fileMode(f g2g.DiffFile) *string {
+	if f.Mode == 0 {
+		return nil
+	}
+	mode := strconv.FormatUint(uint64(f.Mode), 8)
+	return &mode
+}
+
+// blobID returns the ID of the content of a diff file, or nil if the file does
+// not exist on its side of the diff.
+func blobID(f g2g.DiffFile) *string {
+	if f.Oid == nil || f.Oid.IsZero() {
+		return nil
+	}
+	id := f.Oid.String()
+	return &id
+}
+
+// lineNumber converts a libgit2 line number, which is -1 for lines that do
+// not exist on one side of a diff, to a model line number.
+func lineNumber(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// discoverGitDir returns the path to the git directory of the repository
+// found at path, which may either be a working directory or a git directory.
+// Parent directories of path are not searched.
+func discoverGitDir(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer f.Close()
 
-	bs, err := ioutil.ReadAll(f)
+	return g2g.Discover(absPath, false, []string{filepath.Dir(absPath)})
+}
+
+// diffOptions returns the options used to compute the diff between a commit
+// and its parent.
+func (gr *gitRepo) diffOptions() (g2g.DiffOptions, error) {
+	opts, err := g2g.DefaultDiffOptions()
 	if err != nil {
-		return nil, err
+		return opts, err
+	}
+
+	// report type changes as such, rather than as a deletion and an addition
+	opts.Flags |= g2g.DiffIncludeTypeChange
+
+	if gr.cfg.IgnoreWhitespace {
+		opts.Flags |= g2g.DiffIgnoreWhitespace
+	}
+	if gr.cfg.ContextLines != nil {
+		opts.ContextLines = uint32(*gr.cfg.ContextLines)
+	}
+	if gr.cfg.MaxPatchSize > 0 {
+		opts.MaxSize = gr.cfg.MaxPatchSize
 	}
 
-	re := regexp.MustCompile("url ?= ?(.+)")
-	match := re.FindStringSubmatch(string(bs))
-	if len(match) != 2 {
-		return nil, errors.New("invalid git config file")
+	pf := pathFilter{include: gr.cfg.IncludePaths, exclude: gr.cfg.ExcludePaths}
+	if !pf.isEmpty() {
+		opts.NotifyCallback = func(_ *g2g.Diff, delta g2g.DiffDelta, _ string) error {
+			if pf.keep(delta.NewFile.Path) || pf.keep(delta.OldFile.Path) {
+				return nil
+			}
+			return g2g.ErrDeltaSkip
+		}
 	}
 
-	if len(match[1]) == 0 {
-		return nil, errors.New("cannot extract git clone url")
+	if gr.cfg.FindCopiesFromUnmodified {
+		// unmodified files can only be copy sources if they are part of the
+		// diff
+		opts.Flags |= g2g.DiffIncludeUnmodified
 	}
 
-	return &match[1], nil
+	return opts, nil
 }
 
-// extractGitDefaultBranch returns the branch to which HEAD of a git
-// repository is pointing at.
-func extractGitDefaultBranch(path string) (*string, error) {
-	f, err := os.Open(filepath.Join(path, ".git", "HEAD"))
+// diffFindOptions returns the options used to detect renamed and copied files.
+func (gr *gitRepo) diffFindOptions() (g2g.DiffFindOptions, error) {
+	opts, err := g2g.DefaultDiffFindOptions()
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Flags = g2g.DiffFindRenames
+	if gr.cfg.FindCopies || gr.cfg.FindCopiesFromUnmodified {
+		opts.Flags |= g2g.DiffFindCopies
+	}
+	if gr.cfg.FindCopiesFromUnmodified {
+		opts.Flags |= g2g.DiffFindCopiesFromUnmodified | g2g.DiffFindRemoveUnmodified
+	}
+
+	if gr.cfg.RenameThreshold > 0 {
+		opts.RenameThreshold = gr.cfg.RenameThreshold
+	}
+	if gr.cfg.CopyThreshold > 0 {
+		opts.CopyThreshold = gr.cfg.CopyThreshold
+	}
+	if gr.cfg.RenameLimit > 0 {
+		opts.RenameLimit = gr.cfg.RenameLimit
+	}
+
+	return opts, nil
+}
+
+// extractGitRemotes returns the remotes of a git repository along with
+// their URL, url.<base>.insteadOf rules being applied.
+// Remotes are returned in the order in which they appear in the configuration.
+func extractGitRemotes(r *g2g.Repository) ([]model.Remote, error) {
+	c, err := r.Config()
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	defer c.Free()
 
-	bs, err := ioutil.ReadAll(f)
+	insteadOf := map[string]string{}
+	err = iterateGitConfig(c, `^url\..*\.insteadof$`, func(e *g2g.ConfigEntry) {
+		base := strings.TrimSuffix(strings.TrimPrefix(e.Name, "url."), ".insteadof")
+		insteadOf[e.Value] = base
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	re := regexp.MustCompile("ref: refs\\/heads\\/[a-zA-Z0-9].+")
-	match := re.FindString(string(bs))
-	if len(match) == 0 {
-		return nil, errors.New("no branch (detached HEAD state)")
+	var remotes []model.Remote
+	err = iterateGitConfig(c, `^remote\..*\.url$`, func(e *g2g.ConfigEntry) {
+		name := strings.TrimSuffix(strings.TrimPrefix(e.Name, "remote."), ".url")
+		remotes = append(remotes, model.Remote{Name: name, URL: rewriteURL(e.Value, insteadOf)})
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	index := strings.LastIndex(match, "/")
-	branch := string(match[index+1:])
-	if len(branch) == 0 {
-		// we shall not be able to reach here but just in case
-		return nil, errors.New("no branch (detached HEAD state)")
+	return remotes, nil
+}
+
+// iterateGitConfig calls fn for each git configuration entry whose name
+// matches the regular expression re.
+func iterateGitConfig(c *g2g.Config, re string, fn func(*g2g.ConfigEntry)) error {
+	it, err := c.NewIteratorGlob(re)
+	if err != nil {
+		return err
+	}
+	defer it.Free()
+
+	for {
+		e, err := it.Next()
+		if g2g.IsErrorCode(err, g2g.ErrIterOver) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(e)
+	}
+}
+
+// extractGitURL returns a git repository clone URL as a string, given its
+// remotes. The URL of the preferred remote is used if it exists, otherwise
+// the one of the first remote.
+func extractGitURL(remotes []model.Remote, preferred string) (*string, error) {
+	if len(preferred) == 0 {
+		preferred = defaultRemote
+	}
+
+	for _, remote := range remotes {
+		if remote.Name == preferred && len(remote.URL) > 0 {
+			return &remote.URL, nil
+		}
+	}
+
+	for _, remote := range remotes {
+		if len(remote.URL) > 0 {
+			return &remote.URL, nil
+		}
 	}
 
-	return &branch, nil
+	return nil, errors.New("cannot extract git clone url")
 }
 
-// untarGitFolder extracts the root's .git directory contained in a tar archive
-// of a git repository into destPath.
-func untarGitFolder(destPath, archivePath string) error {
+// extractGitHead returns the branch to which HEAD of a git repository is
+// pointing at, as a full reference name (refs/heads/feature/login), along
+// with the ID of the commit HEAD points to.
+// When HEAD is detached, the branch HEAD of the given remote points to is
+// used instead (refs/remotes/origin/master), if any, otherwise the branch is
+// the commit ID. In an empty repository, HEAD points to a branch which does
+// not exist yet, and there is no commit ID.
+func extractGitHead(r *g2g.Repository, remote string) (string, string, error) {
+	head, err := r.Head()
+	if g2g.IsErrorCode(err, g2g.ErrUnbornBranch) {
+		ref, err := r.LookupReference("HEAD")
+		if err != nil {
+			return "", "", err
+		}
+		defer ref.Free()
+		return ref.SymbolicTarget(), "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	defer head.Free()
+
+	if head.Target() == nil {
+		return "", "", errors.New("cannot resolve HEAD")
+	}
+	commitID := head.Target().String()
+
+	detached, err := r.IsHeadDetached()
+	if err != nil {
+		return "", "", err
+	}
+	if !detached {
+		return head.Name(), commitID, nil
+	}
+
+	if len(remote) == 0 {
+		remote = defaultRemote
+	}
+	remotePrefix := "refs/remotes/" + remote + "/"
+	if remoteHead, err := r.LookupReference(remotePrefix + "HEAD"); err == nil {
+		defer remoteHead.Free()
+		if target := remoteHead.SymbolicTarget(); strings.HasPrefix(target, remotePrefix) {
+			return target, commitID, nil
+		}
+	}
+
+	return commitID, commitID, nil
+}
+
+// untarGitFolder extracts the git directory gitDir contained in a tar archive
+// of a git repository into destPath/.git, gitDir being relative to the archive
+// root, as returned by findArchiveGitDir.
+// When objects is not nil, object files (loose objects, packfiles and their
+// indexes) are not extracted but their location in the archive is recorded
+// in objects, for them to be read straight from the archive.
+// Since archives may come from untrusted sources, entries that are absolute
+// paths, contain '..' components, are links pointing outside of the git
+// directory or would be written through a symbolic link are rejected, as well
+// as archives exceeding the size limits set in cfg. In such cases, a
+// *TarEntryError is returned.
+func untarGitFolder(cfg config.DataConfig, destPath, archivePath, gitDir string, objects *tarObjects) error {
 	var err error
 
 	archiveFile, err := os.Open(archivePath)
@@ -309,17 +986,19 @@ func untarGitFolder(destPath, archivePath string) error {
 	}
 	defer archiveFile.Close()
 
-	// make sure to create dest path
-	if err = os.MkdirAll(destPath, os.ModePerm); err != nil {
+	// make sure to create dest path, with an objects directory as libgit2
+	// expects one, even when objects are read from the archive
+	dotGitPath := filepath.Join(destPath, ".git")
+	if err = os.MkdirAll(filepath.Join(dotGitPath, "objects"), os.ModePerm); err != nil {
 		return err
 	}
 
+	fileLimit := gigaBytesToBytes(cfg.TarFileSizeLimit)
+	totalLimit := gigaBytesToBytes(cfg.TarSizeLimit)
+	var totalSize int64
+
 	tr := tar.NewReader(archiveFile)
 
-	// make sure we keep the trailing /
-	// FIXME not compatible with Windows
-	basePath := filepath.Base(strings.TrimSuffix(archivePath, ".tar"))
-	dotGitDirPath := filepath.Join(basePath, ".git") + "/"
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
@@ -329,37 +1008,126 @@ func untarGitFolder(destPath, archivePath string) error {
 			return err
 		}
 
-		// we only want to extract the .git/ subtree and skip the rest
-		if strings.HasPrefix(hdr.Name, dotGitDirPath) {
-			hdr.Name = strings.TrimPrefix(hdr.Name, basePath)
-			mode := hdr.FileInfo().Mode()
-			switch {
-			case mode&os.ModeDir != 0:
-				if err := os.Mkdir(filepath.Join(destPath, hdr.Name), mode); err != nil {
+		entryErr := func(err error) error {
+			return &TarEntryError{Archive: archivePath, Entry: hdr.Name, Err: err}
+		}
+
+		if err := checkTarEntryName(hdr.Name); err != nil {
+			return entryErr(err)
+		}
+
+		// we only want to extract the git directory subtree and skip the rest
+		name := normalizeTarEntryName(hdr.Name)
+		if !strings.HasPrefix(name, gitDir) {
+			continue
+		}
+
+		rel := strings.TrimPrefix(name, gitDir)
+		target := filepath.Join(dotGitPath, filepath.FromSlash(rel))
+		if !isWithin(dotGitPath, target) {
+			return entryErr(ErrPathTraversal)
+		}
+
+		// links already extracted must not redirect what is written next
+		if err := checkNoSymlink(dotGitPath, target); err != nil {
+			return entryErr(err)
+		}
+
+		mode := hdr.FileInfo().Mode()
+		if mode&os.ModeDir == 0 {
+			// not all archives contain entries for directories
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case mode&os.ModeDir != 0:
+			if err := os.MkdirAll(target, mode.Perm()|0700); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			if err := checkSymlink(dotGitPath, target, hdr.Linkname); err != nil {
+				return entryErr(err)
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA:
+			if fileLimit > 0 && hdr.Size > fileLimit {
+				return entryErr(ErrFileTooLarge)
+			}
+
+			// the tar reader does not buffer, hence the current offset of
+			// the archive is the one of the content of the entry; the
+			// content of sparse files is not stored as is though
+			if objects != nil && !isSparseTarEntry(hdr) {
+				offset, err := archiveFile.Seek(0, io.SeekCurrent)
+				if err != nil {
 					return err
 				}
-			case mode&os.ModeSymlink != 0:
-				os.Symlink(hdr.Linkname, filepath.Join(destPath, hdr.Name))
-			default: // consider it a regular file
-				createFile := func() error {
-					f, err := os.Create(filepath.Join(destPath, hdr.Name))
-					if err != nil {
-						return err
-					}
-					defer f.Close()
-
-					if _, err := io.Copy(f, tr); err != nil {
-						return err
-					}
-					return nil
+				if objects.add(rel, tarSection{offset: offset, size: hdr.Size}) {
+					continue
+				}
+			}
+
+			totalSize += hdr.Size
+			if totalLimit > 0 && totalSize > totalLimit {
+				return entryErr(ErrArchiveTooLarge)
+			}
+
+			createFile := func() error {
+				f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm()|0600)
+				if err != nil {
+					return err
 				}
+				defer f.Close()
 
-				if err = createFile(); err != nil {
+				if _, err := io.Copy(f, io.LimitReader(tr, hdr.Size)); err != nil {
 					return err
 				}
+				return nil
+			}
+
+			if err = createFile(); err != nil {
+				return err
 			}
+		case hdr.Typeflag == tar.TypeLink:
+			// hard links refer to another entry of the archive
+			linkname := normalizeTarEntryName(hdr.Linkname)
+			if err := checkTarEntryName(linkname); err != nil {
+				return entryErr(err)
+			}
+			if !strings.HasPrefix(linkname, gitDir) {
+				return entryErr(ErrSymlinkEscape)
+			}
+			oldRel := strings.TrimPrefix(linkname, gitDir)
+			if objects != nil {
+				if section, ok := objects.section(oldRel); ok && objects.add(rel, section) {
+					continue
+				}
+			}
+			oldname := filepath.Join(dotGitPath, filepath.FromSlash(oldRel))
+			if err := checkNoSymlink(dotGitPath, oldname); err != nil {
+				return entryErr(err)
+			}
+			if err := os.Link(oldname, target); err != nil {
+				return err
+			}
+		default:
+			// devices, fifos and the like have no business in a .git directory
+			return entryErr(ErrUnsupportedEntry)
 		}
 	}
 
+	if objects != nil {
+		return objects.load()
+	}
 	return nil
 }
+
+// tzOffset returns the offset from UTC, in minutes, of the timezone of t.
+func tzOffset(t time.Time) int {
+	_, offset := t.Zone()
+	return offset / 60
+}
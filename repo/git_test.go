@@ -0,0 +1,96 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import "testing"
+
+func TestPatchStats(t *testing.T) {
+	tests := []struct {
+		name                         string
+		patch                        string
+		insertions, deletions, hunks int
+	}{
+		{name: "empty"},
+		{
+			name: "modification",
+			patch: `diff --git a/foo.go b/foo.go
+index 3b18e51..a042389 100644
+--- a/foo.go
++++ b/foo.go
+@@ -1,3 +1,4 @@
+ package foo
+-var a = 1
++var a = 2
++var b = 3
+
+@@ -10,2 +11,1 @@ func f() {
+--- not a header
+-	return
++++ not a header either
+`,
+			insertions: 3,
+			deletions:  3,
+			hunks:      2,
+		},
+		{
+			name: "no newline at end of file",
+			patch: `diff --git a/foo b/foo
+--- a/foo
++++ b/foo
+@@ -1 +1 @@
+-foo
+\ No newline at end of file
++bar
+\ No newline at end of file`,
+			insertions: 1,
+			deletions:  1,
+			hunks:      1,
+		},
+		{
+			name: "binary",
+			patch: `diff --git a/img.png b/img.png
+index 3b18e51..a042389 100644
+Binary files a/img.png and b/img.png differ
+`,
+		},
+		{
+			name: "pure rename",
+			patch: `diff --git a/old.go b/new.go
+similarity index 100%
+rename from old.go
+rename to new.go
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		insertions, deletions, hunks := patchStats(tt.patch)
+		if insertions != tt.insertions || deletions != tt.deletions || hunks != tt.hunks {
+			t.Errorf("%s: got +%d -%d %d hunks, want +%d -%d %d hunks", tt.name,
+				insertions, deletions, hunks, tt.insertions, tt.deletions, tt.hunks)
+		}
+	}
+}
+
+func TestNotesRef(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"commits", "refs/notes/commits"},
+		{"review", "refs/notes/review"},
+		{"notes/review", "refs/notes/review"},
+		{"refs/notes/review", "refs/notes/review"},
+		{"refs/notes/ci/builds", "refs/notes/ci/builds"},
+		{"ci/builds", "refs/notes/ci/builds"},
+		{"refs/heads/master", "refs/notes/refs/heads/master"},
+	}
+
+	for _, tt := range tests {
+		if got := notesRef(tt.name); got != tt.want {
+			t.Errorf("notesRef(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+
+	"github.com/DevMine/repotool/model"
+)
+
+// lineageFile is a file of a lineage index.
+type lineageFile struct {
+	// paths of the file, the latest one first
+	paths   []string
+	changes []model.FileChange
+	deleted bool
+
+	copiedFrom *lineageFile
+
+	// oldest commit known to have touched the file, and path of the file in
+	// this commit
+	oldestCommit string
+	oldestPath   string
+}
+
+// seen records that the file was found at path p in a commit, which must be
+// older than the commits it was found in so far.
+func (f *lineageFile) seen(commit, p string) {
+	f.oldestCommit, f.oldestPath = commit, p
+	if f.paths[len(f.paths)-1] != p {
+		f.paths = append(f.paths, p)
+	}
+}
+
+// id computes the ID of the file.
+func (f *lineageFile) id() string {
+	h := sha1.New()
+	h.Write([]byte(f.oldestCommit))
+	h.Write([]byte{0})
+	h.Write([]byte(f.oldestPath))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// lineage is an index of the files of a repository, which links the paths of
+// files across renames and copies. It is built from the deltas of commits,
+// given from the newest to the oldest one.
+type lineage struct {
+	files []*lineageFile
+
+	// byPath maps paths to the files found there before the commits added
+	// so far were made.
+	byPath map[string]*lineageFile
+}
+
+// newLineage creates an empty lineage index.
+func newLineage() *lineage {
+	return &lineage{byPath: make(map[string]*lineageFile)}
+}
+
+// file returns the file found at path p before the commits added so far were
+// made, creating it if unknown.
+func (l *lineage) file(p string) *lineageFile {
+	if f, ok := l.byPath[p]; ok {
+		return f
+	}
+
+	f := &lineageFile{paths: []string{p}}
+	l.files = append(l.files, f)
+	l.byPath[p] = f
+	return f
+}
+
+// add adds the changes made by a commit to the index. The commit must be
+// older than the commits added so far.
+func (l *lineage) add(c model.Commit) {
+	// files renamed by the commit, by old path, and copied files, by source
+	// path
+	moved := make(map[string]*lineageFile)
+	copied := make(map[*lineageFile]string)
+
+	// paths which did not exist before the commit
+	var created []string
+
+	for _, d := range c.DiffDelta {
+		if d.Status == nil || d.OldFilePath == nil || d.NewFilePath == nil {
+			continue
+		}
+		if d.Submodule != nil && *d.Submodule {
+			continue
+		}
+
+		status, oldPath, newPath := *d.Status, *d.OldFilePath, *d.NewFilePath
+		p := newPath
+		if status == model.StatusDeleted {
+			p = oldPath
+		}
+
+		f, ok := l.byPath[p]
+		if !ok && status == model.StatusRenamed {
+			// with non linear histories, a rename may have been seen
+			// through a merge commit already
+			f, ok = l.byPath[oldPath]
+		}
+		if !ok {
+			f = l.file(p)
+			f.deleted = status == model.StatusDeleted
+		}
+
+		change := model.FileChange{Commit: c.VCSID, Status: status, Path: p, Similarity: d.Similarity}
+		if status == model.StatusRenamed || status == model.StatusCopied {
+			change.OldPath = oldPath
+		}
+		f.changes = append(f.changes, change)
+
+		switch status {
+		case model.StatusRenamed:
+			f.seen(c.VCSID, oldPath)
+			moved[oldPath] = f
+			created = append(created, newPath)
+		case model.StatusCopied:
+			f.seen(c.VCSID, newPath)
+			copied[f] = oldPath
+			created = append(created, newPath)
+		case model.StatusAdded:
+			f.seen(c.VCSID, newPath)
+			created = append(created, newPath)
+		default:
+			f.seen(c.VCSID, p)
+		}
+	}
+
+	for _, p := range created {
+		if _, ok := moved[p]; !ok {
+			delete(l.byPath, p)
+		}
+	}
+	for p, f := range moved {
+		l.byPath[p] = f
+	}
+
+	// copy sources are looked up once the paths are the ones before the
+	// commit
+	for f, p := range copied {
+		src := l.file(p)
+		if src.oldestCommit != c.VCSID {
+			src.seen(c.VCSID, p)
+		}
+		f.copiedFrom = src
+	}
+}
+
+// modelFiles returns the files of the index, sorted by path.
+func (l *lineage) modelFiles() []model.File {
+	files := make([]model.File, 0, len(l.files))
+	for _, f := range l.files {
+		mf := model.File{
+			ID:      f.id(),
+			Path:    f.paths[0],
+			Paths:   f.paths,
+			Deleted: f.deleted,
+			Changes: f.changes,
+		}
+		if mf.Changes == nil {
+			mf.Changes = make([]model.FileChange, 0)
+		}
+		if f.copiedFrom != nil {
+			mf.CopiedFrom = f.copiedFrom.id()
+		}
+		files = append(files, mf)
+	}
+
+	sort.Sort(filesByPath(files))
+	return files
+}
+
+// fileHistory returns the history of the file found at path p, or of the
+// files which were found there at some point if no file is currently found
+// there.
+func fileHistory(files []model.File, commits []model.Commit, p string) *model.FileHistory {
+	byID := make(map[string]model.File)
+	var matches, former []model.File
+	for _, f := range files {
+		byID[f.ID] = f
+		if f.Path == p {
+			matches = append(matches, f)
+			continue
+		}
+		for _, fp := range f.Paths {
+			if fp == p {
+				former = append(former, f)
+				break
+			}
+		}
+	}
+	matches = append(matches, former...)
+
+	// position of commits, from the newest one
+	pos := make(map[string]int, len(commits))
+	for i, c := range commits {
+		pos[c.VCSID] = i
+	}
+
+	// paths of the files in the commits which touched them; the files
+	// copied from are only followed up to the copies
+	type commitPath struct {
+		commit string
+		path   string
+	}
+	touched := make(map[commitPath]bool)
+
+	seen := make(map[string]bool)
+	h := &model.FileHistory{Files: make([]model.File, 0), Commits: make([]model.Commit, 0)}
+	for _, f := range matches {
+		after := -1
+		for ok := true; ok && !seen[f.ID]; f, ok = byID[f.CopiedFrom] {
+			seen[f.ID] = true
+			h.Files = append(h.Files, f)
+			for _, c := range f.Changes {
+				if pos[c.Commit] > after {
+					touched[commitPath{c.Commit, c.Path}] = true
+				}
+			}
+			if n := len(f.Changes); n > 0 {
+				after = pos[f.Changes[n-1].Commit]
+			}
+		}
+	}
+
+	for _, c := range commits {
+		var deltas []model.DiffDelta
+		for _, d := range c.DiffDelta {
+			if d.NewFilePath != nil && touched[commitPath{c.VCSID, *d.NewFilePath}] ||
+				d.OldFilePath != nil && touched[commitPath{c.VCSID, *d.OldFilePath}] {
+				deltas = append(deltas, d)
+			}
+		}
+		if len(deltas) > 0 {
+			c.DiffDelta = deltas
+			h.Commits = append(h.Commits, c)
+		}
+	}
+
+	return h
+}
+
+// filesByPath implements sort.Interface to sort files by path, then by ID.
+type filesByPath []model.File
+
+func (f filesByPath) Len() int      { return len(f) }
+func (f filesByPath) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+func (f filesByPath) Less(i, j int) bool {
+	if f[i].Path != f[j].Path {
+		return f[i].Path < f[j].Path
+	}
+	return f[i].ID < f[j].ID
+}
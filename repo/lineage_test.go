@@ -0,0 +1,118 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/DevMine/repotool/model"
+)
+
+// lineageCommit returns a commit made of deltas, each given as a status, an
+// old path and a new path, both paths being set as git does.
+func lineageCommit(id string, deltas ...[3]string) model.Commit {
+	c := model.Commit{VCSID: id}
+	for _, d := range deltas {
+		status, oldPath, newPath := d[0], d[1], d[2]
+		c.DiffDelta = append(c.DiffDelta, model.DiffDelta{
+			Status:      &status,
+			OldFilePath: &oldPath,
+			NewFilePath: &newPath,
+		})
+	}
+	return c
+}
+
+// fileID returns the ID of a file whose oldest known commit is commit, in
+// which it was found at path p.
+func fileID(commit, p string) string {
+	h := sha1.Sum([]byte(commit + "\x00" + p))
+	return hex.EncodeToString(h[:])
+}
+
+func TestLineage(t *testing.T) {
+	added, deleted := model.StatusAdded, model.StatusDeleted
+	modified := model.StatusModified
+	renamed, copied := model.StatusRenamed, model.StatusCopied
+
+	tests := []struct {
+		name string
+		// commits, from the newest to the oldest one
+		commits []model.Commit
+		want    []model.File
+	}{
+		{
+			name: "rename chain",
+			commits: []model.Commit{
+				lineageCommit("c4", [3]string{modified, "C", "C"}),
+				lineageCommit("c3", [3]string{renamed, "B", "C"}),
+				lineageCommit("c2", [3]string{renamed, "A", "B"}),
+				lineageCommit("c1", [3]string{added, "A", "A"}),
+			},
+			want: []model.File{
+				{ID: fileID("c1", "A"), Path: "C", Paths: []string{"C", "B", "A"}, Changes: []model.FileChange{
+					{Commit: "c4", Status: modified, Path: "C"},
+					{Commit: "c3", Status: renamed, OldPath: "B", Path: "C"},
+					{Commit: "c2", Status: renamed, OldPath: "A", Path: "B"},
+					{Commit: "c1", Status: added, Path: "A"},
+				}},
+			},
+		},
+		{
+			name: "copy",
+			commits: []model.Commit{
+				lineageCommit("c4", [3]string{modified, "B", "B"}),
+				lineageCommit("c3", [3]string{copied, "A", "B"}),
+				lineageCommit("c2", [3]string{modified, "A", "A"}),
+				lineageCommit("c1", [3]string{added, "A", "A"}),
+			},
+			want: []model.File{
+				{ID: fileID("c1", "A"), Path: "A", Paths: []string{"A"}, Changes: []model.FileChange{
+					{Commit: "c2", Status: modified, Path: "A"},
+					{Commit: "c1", Status: added, Path: "A"},
+				}},
+				{ID: fileID("c3", "B"), Path: "B", Paths: []string{"B"}, CopiedFrom: fileID("c1", "A"), Changes: []model.FileChange{
+					{Commit: "c4", Status: modified, Path: "B"},
+					{Commit: "c3", Status: copied, OldPath: "A", Path: "B"},
+				}},
+			},
+		},
+		{
+			name: "path added again after a deletion",
+			commits: []model.Commit{
+				lineageCommit("c4", [3]string{modified, "A", "A"}),
+				lineageCommit("c3", [3]string{added, "A", "A"}),
+				lineageCommit("c2", [3]string{deleted, "A", "A"}),
+				lineageCommit("c1", [3]string{added, "A", "A"}),
+			},
+			want: []model.File{
+				{ID: fileID("c1", "A"), Path: "A", Paths: []string{"A"}, Deleted: true, Changes: []model.FileChange{
+					{Commit: "c2", Status: deleted, Path: "A"},
+					{Commit: "c1", Status: added, Path: "A"},
+				}},
+				{ID: fileID("c3", "A"), Path: "A", Paths: []string{"A"}, Changes: []model.FileChange{
+					{Commit: "c4", Status: modified, Path: "A"},
+					{Commit: "c3", Status: added, Path: "A"},
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := newLineage()
+		for _, c := range tt.commits {
+			l.add(c)
+		}
+
+		sort.Sort(filesByPath(tt.want))
+		if got := l.modelFiles(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
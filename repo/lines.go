@@ -0,0 +1,36 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import "bytes"
+
+// CountLines returns the number of lines of each text file of the tree HEAD
+// points to, by path. Files left out by the path filter are ignored.
+func (gr *gitRepo) CountLines() (map[string]int, error) {
+	_, tfs, err := gr.headTextFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(map[string]int, len(tfs))
+	for _, tf := range tfs {
+		blob, err := gr.r.LookupBlob(tf.id)
+		if err != nil {
+			return nil, err
+		}
+
+		content := blob.Contents()
+		n := bytes.Count(content, []byte{'\n'})
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			// last line without a newline
+			n++
+		}
+		lines[tf.path] = n
+
+		blob.Free()
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"io/ioutil"
+	"strings"
+
+	g2g "github.com/libgit2/git2go"
+
+	"github.com/DevMine/repotool/model"
+)
+
+// mailmapIdentity is the canonical identity a mailmap maps identities to.
+// Empty fields are left unchanged.
+type mailmapIdentity struct {
+	name  string
+	email string
+}
+
+// mailmap maps the identities found in commits to canonical identities, as
+// described in git-check-mailmap(1). It maps lowercased emails to lowercased
+// names, the empty name standing for any name, to canonical identities.
+type mailmap map[string]map[string]mailmapIdentity
+
+// parse adds the mappings of the content of a mailmap file, whose lines are
+// in one of the following forms:
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+//
+// Lines starting with "#" are comments. Invalid lines are ignored.
+func (mm mailmap) parse(content string) {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		name1, email1, rest, ok := parseMailmapIdentity(line)
+		if !ok {
+			continue
+		}
+		name2, email2, _, ok := parseMailmapIdentity(rest)
+		if !ok {
+			// "Proper Name <commit@email>"
+			mm.add(mailmapIdentity{name: name1}, "", email1)
+			continue
+		}
+		mm.add(mailmapIdentity{name: name1, email: email1}, name2, email2)
+	}
+}
+
+// parseMailmapIdentity parses the first "[Name] <email>" found in s and
+// returns the remaining of s.
+func parseMailmapIdentity(s string) (name, email, rest string, ok bool) {
+	lt := strings.Index(s, "<")
+	if lt < 0 {
+		return "", "", "", false
+	}
+	gt := strings.Index(s[lt:], ">")
+	if gt < 0 {
+		return "", "", "", false
+	}
+	gt += lt
+
+	return strings.TrimSpace(s[:lt]), strings.TrimSpace(s[lt+1 : gt]), s[gt+1:], true
+}
+
+// add maps the identity made of name and email to id. As git does, fields of
+// id override the ones of the identity previously mapped, if any, only when
+// not empty.
+func (mm mailmap) add(id mailmapIdentity, name, email string) {
+	email = strings.ToLower(email)
+	names, ok := mm[email]
+	if !ok {
+		names = make(map[string]mailmapIdentity)
+		mm[email] = names
+	}
+
+	name = strings.ToLower(name)
+	old := names[name]
+	if len(id.name) == 0 {
+		id.name = old.name
+	}
+	if len(id.email) == 0 {
+		id.email = old.email
+	}
+	names[name] = id
+}
+
+// developer returns the developer whose raw identity is made of name and
+// email, along with their canonical identity.
+func (mm mailmap) developer(name, email string) model.Developer {
+	dev := model.Developer{
+		Name:           name,
+		Email:          email,
+		CanonicalName:  name,
+		CanonicalEmail: email,
+	}
+
+	names, ok := mm[strings.ToLower(email)]
+	if !ok {
+		return dev
+	}
+	id, ok := names[strings.ToLower(name)]
+	if !ok {
+		if id, ok = names[""]; !ok {
+			return dev
+		}
+	}
+
+	if len(id.name) > 0 {
+		dev.CanonicalName = id.name
+	}
+	if len(id.email) > 0 {
+		dev.CanonicalEmail = id.email
+	}
+	return dev
+}
+
+// readGitMailmap reads the .mailmap file found at the root of the tree HEAD
+// points to, if any, then the global mailmap file, if given. Mappings of the
+// latter take precedence.
+func readGitMailmap(r *g2g.Repository, globalFile string) (mailmap, error) {
+	mm := make(mailmap)
+
+	content, err := headFileContent(r, ".mailmap")
+	if err != nil {
+		return nil, err
+	}
+	mm.parse(string(content))
+
+	if len(globalFile) > 0 {
+		bs, err := ioutil.ReadFile(globalFile)
+		if err != nil {
+			return nil, err
+		}
+		mm.parse(string(bs))
+	}
+
+	return mm, nil
+}
+
+// headFileContent returns the content of the file found at path in the tree
+// HEAD points to, or nil if there is no such file (or no commit at all).
+func headFileContent(r *g2g.Repository, path string) ([]byte, error) {
+	head, err := r.Head()
+	if g2g.IsErrorCode(err, g2g.ErrUnbornBranch) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer head.Free()
+
+	commit, err := r.LookupCommit(head.Target())
+	if err != nil {
+		return nil, err
+	}
+	defer commit.Free()
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Free()
+
+	entry, err := tree.EntryByPath(path)
+	if g2g.IsErrorCode(err, g2g.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := r.LookupBlob(entry.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Free()
+
+	// the content belongs to libgit2 and is not valid once the blob freed
+	return append([]byte(nil), blob.Contents()...), nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"testing"
+
+	"github.com/DevMine/repotool/model"
+)
+
+func TestParseMailmapIdentity(t *testing.T) {
+	tests := []struct {
+		s     string
+		name  string
+		email string
+		rest  string
+		ok    bool
+	}{
+		{"", "", "", "", false},
+		{"Jane Doe", "", "", "", false},
+		{"Jane Doe <jane@example.org", "", "", "", false},
+		{"Jane Doe <jane@example.org>", "Jane Doe", "jane@example.org", "", true},
+		{"  Jane Doe   < jane@example.org > ", "Jane Doe", "jane@example.org", " ", true},
+		{"<jane@example.org> <jd@example.org>", "", "jane@example.org", " <jd@example.org>", true},
+		{"Jane Doe <jane@example.org> J. Doe <jd@example.org>", "Jane Doe", "jane@example.org", " J. Doe <jd@example.org>", true},
+		{"<>", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		name, email, rest, ok := parseMailmapIdentity(tt.s)
+		if name != tt.name || email != tt.email || rest != tt.rest || ok != tt.ok {
+			t.Errorf("parseMailmapIdentity(%q) = %q, %q, %q, %v, want %q, %q, %q, %v", tt.s,
+				name, email, rest, ok, tt.name, tt.email, tt.rest, tt.ok)
+		}
+	}
+}
+
+func TestMailmap(t *testing.T) {
+	mm := make(mailmap)
+	mm.parse(`# a comment
+Jane Doe <jane@example.org>
+<jane@example.org> <jane@old.example.org>
+John Doe <john@example.org> <JOHN@laptop>
+John Doe <john@example.org> root <root@localhost>
+invalid line
+  # another comment
+Jim Doe <root@localhost>
+`)
+	// a later mapping only overrides non empty fields
+	mm.parse("<jane.doe@example.org> <jane@old.example.org>")
+
+	tests := []struct {
+		name  string
+		email string
+		want  model.Developer
+	}{
+		{
+			"jane", "jane@example.org",
+			model.Developer{Name: "jane", Email: "jane@example.org", CanonicalName: "Jane Doe", CanonicalEmail: "jane@example.org"},
+		},
+		{
+			"Jane", "jane@old.example.org",
+			model.Developer{Name: "Jane", Email: "jane@old.example.org", CanonicalName: "Jane", CanonicalEmail: "jane.doe@example.org"},
+		},
+		{
+			"Whoever", "john@Laptop",
+			model.Developer{Name: "Whoever", Email: "john@Laptop", CanonicalName: "John Doe", CanonicalEmail: "john@example.org"},
+		},
+		{
+			"Root", "root@localhost",
+			model.Developer{Name: "Root", Email: "root@localhost", CanonicalName: "John Doe", CanonicalEmail: "john@example.org"},
+		},
+		{
+			"admin", "root@localhost",
+			model.Developer{Name: "admin", Email: "root@localhost", CanonicalName: "Jim Doe", CanonicalEmail: "root@localhost"},
+		},
+		{
+			"Nobody", "nobody@example.org",
+			model.Developer{Name: "Nobody", Email: "nobody@example.org", CanonicalName: "Nobody", CanonicalEmail: "nobody@example.org"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := mm.developer(tt.name, tt.email); got != tt.want {
+			t.Errorf("developer(%q, %q) = %+v, want %+v", tt.name, tt.email, got, tt.want)
+		}
+	}
+}
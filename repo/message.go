@@ -0,0 +1,292 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/DevMine/repotool/model"
+)
+
+// trailerRe matches a trailer line ("Key: value").
+var trailerRe = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*)\s*:\s*(.*)$`)
+
+// gitTrailerPrefixes are the trailers added by git itself. A trailers block
+// containing one of them may also contain lines which are not trailers.
+var gitTrailerPrefixes = []string{
+	"Signed-off-by: ",
+	"(cherry picked from commit ",
+}
+
+// coAuthorKey is the key of the trailer used to credit co-authors.
+const coAuthorKey = "co-authored-by"
+
+// issueRefRe matches, in this order, issue URLs, GitHub style references
+// ([owner/repo]#123), GH-123 references and JIRA style keys (PROJ-123).
+var issueRefRe = regexp.MustCompile(
+	`(https?://[^\s<>()\[\]]+)` +
+		`|(?:([A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+))?#([0-9]+)` +
+		`|\bGH-([0-9]+)` +
+		`|\b([A-Z][A-Z0-9]+-[0-9]+)`)
+
+// issueURLRes match the URLs of issues and pull requests of the most common
+// forges and trackers. The first submatch is the repository, if any, and the
+// last one the ID.
+var issueURLRes = []*regexp.Regexp{
+	// GitHub, GitLab, Gitea, ...
+	regexp.MustCompile(`^https?://[^/]+/([^/]+/.+?)/(?:-/)?(?:issues|pull|pulls|merge_requests)/([0-9]+)/?(?:[#?].*)?$`),
+	// JIRA
+	regexp.MustCompile(`^https?://[^/]+()/(?:.+/)?browse/([A-Z][A-Z0-9]+-[0-9]+)/?(?:[#?].*)?$`),
+}
+
+// issueKeywordRe matches a keyword preceding an issue reference.
+var issueKeywordRe = regexp.MustCompile(
+	`(?i)\b(close[sd]?|fix(?:e[sd])?|resolve[sd]?|refs?|references?|see|related to|part of)\s*:?\s*$`)
+
+// issueListSepRe matches the separators of a list of issue references.
+var issueListSepRe = regexp.MustCompile(`(?i)^\s*(?:,|and|&)?\s*$`)
+
+// notIssueKeys are prefixes of identifiers looking like JIRA keys but which
+// are not issues (UTF-8, SHA-1, ...).
+var notIssueKeys = map[string]bool{
+	"AES":  true,
+	"CVE":  true,
+	"GPL":  true,
+	"HTTP": true,
+	"ISO":  true,
+	"MD":   true,
+	"RFC":  true,
+	"SHA":  true,
+	"SSL":  true,
+	"TLS":  true,
+	"UCS":  true,
+	"UTF":  true,
+}
+
+// parseTrailers extracts the trailers of a commit message, following the
+// rules of git interpret-trailers: trailers are found in the last paragraph
+// of the message, which shall not be the only one, and this paragraph shall
+// only consist of trailers, or contain a trailer added by git and at least
+// 25% of trailers. Values spanning multiple lines are joined.
+func parseTrailers(message string) []model.Trailer {
+	paragraphs := splitParagraphs(message)
+	if len(paragraphs) < 2 {
+		return nil
+	}
+	lines := paragraphs[len(paragraphs)-1]
+
+	var trailers []model.Trailer
+	var nonTrailers int
+	var hasGitTrailer bool
+	var last *model.Trailer
+	for _, line := range lines {
+		for _, prefix := range gitTrailerPrefixes {
+			if strings.HasPrefix(line, prefix) {
+				hasGitTrailer = true
+			}
+		}
+
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && last != nil {
+			// continuation line
+			last.Value += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		match := trailerRe.FindStringSubmatch(line)
+		if match == nil {
+			nonTrailers++
+			last = nil
+			continue
+		}
+
+		trailers = append(trailers, model.Trailer{Key: match[1], Value: strings.TrimSpace(match[2])})
+		last = &trailers[len(trailers)-1]
+	}
+
+	if len(trailers) == 0 {
+		return nil
+	}
+	if nonTrailers > 0 && (!hasGitTrailer || 3*len(trailers) < nonTrailers) {
+		return nil
+	}
+
+	return trailers
+}
+
+// coAuthors returns the developers credited by Co-authored-by trailers.
+// Trailers whose value is not a valid "Name <email>" identity are ignored.
+func coAuthors(trailers []model.Trailer) []model.Developer {
+	var devs []model.Developer
+	for _, t := range trailers {
+		if strings.ToLower(t.Key) != coAuthorKey {
+			continue
+		}
+
+		dev, ok := parseIdentity(t.Value)
+		if !ok {
+			continue
+		}
+		devs = append(devs, dev)
+	}
+	return devs
+}
+
+// parseIdentity parses an identity of the form "Name <email>".
+func parseIdentity(s string) (model.Developer, bool) {
+	lt := strings.LastIndex(s, "<")
+	gt := strings.LastIndex(s, ">")
+	if lt < 0 || gt < lt {
+		return model.Developer{}, false
+	}
+
+	dev := model.Developer{
+		Name:  strings.TrimSpace(s[:lt]),
+		Email: strings.TrimSpace(s[lt+1 : gt]),
+	}
+	if !isDeveloperValid(dev) {
+		return model.Developer{}, false
+	}
+	return dev, true
+}
+
+// splitParagraphs splits a commit message into paragraphs, ie groups of
+// lines separated by blank lines.
+func splitParagraphs(message string) [][]string {
+	var paragraphs [][]string
+	var current []string
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if len(line) == 0 {
+			if len(current) > 0 {
+				paragraphs = append(paragraphs, current)
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, current)
+	}
+	return paragraphs
+}
+
+// splitMessage splits a commit message into its subject and its body. As
+// git does, the subject is the first paragraph of the message, its lines
+// being joined by spaces.
+func splitMessage(message string) (string, string) {
+	lines := strings.Split(message, "\n")
+
+	// skip leading blank lines
+	for len(lines) > 0 && len(strings.TrimSpace(lines[0])) == 0 {
+		lines = lines[1:]
+	}
+
+	var subject []string
+	for len(lines) > 0 && len(strings.TrimSpace(lines[0])) > 0 {
+		subject = append(subject, strings.TrimSpace(lines[0]))
+		lines = lines[1:]
+	}
+
+	// skip the blank lines separating the subject from the body
+	for len(lines) > 0 && len(strings.TrimSpace(lines[0])) == 0 {
+		lines = lines[1:]
+	}
+	body := strings.TrimRight(strings.Join(lines, "\n"), " \t\r\n")
+
+	return strings.Join(subject, " "), body
+}
+
+// parseIssueRefs extracts the references to issues and pull requests found
+// in a commit message, along with the keyword preceding them. In a list of
+// references ("fixes #1, #2 and #3"), the keyword applies to every one of
+// them.
+func parseIssueRefs(message string) []model.IssueRef {
+	var refs []model.IssueRef
+	for _, line := range strings.Split(message, "\n") {
+		var keyword string
+		prev := 0
+		for _, m := range issueRefRe.FindAllStringSubmatchIndex(line, -1) {
+			ref, ok := newIssueRef(line, m)
+			if !ok {
+				continue
+			}
+
+			before := line[prev:m[0]]
+			if km := issueKeywordRe.FindStringSubmatch(before); km != nil {
+				keyword = strings.ToLower(km[1])
+			} else if prev == 0 || !issueListSepRe.MatchString(before) {
+				keyword = ""
+			}
+			ref.Keyword = keyword
+			prev = m[1]
+
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// newIssueRef builds an issue reference out of the submatches m of
+// issueRefRe in line. It returns false if the match is not an issue
+// reference.
+func newIssueRef(line string, m []int) (model.IssueRef, bool) {
+	group := func(i int) string {
+		if m[2*i] < 0 {
+			return ""
+		}
+		return line[m[2*i]:m[2*i+1]]
+	}
+
+	ref := model.IssueRef{Ref: line[m[0]:m[1]]}
+	switch {
+	case m[2] >= 0:
+		u := strings.TrimRight(group(1), ".,;:!?'\"")
+		for _, re := range issueURLRes {
+			if um := re.FindStringSubmatch(u); um != nil {
+				ref.Ref = u
+				ref.URL = u
+				ref.Repository = um[1]
+				ref.ID = um[2]
+				return ref, true
+			}
+		}
+		return model.IssueRef{}, false
+	case m[6] >= 0:
+		// "#" must not be preceded by a word character ("C#1") nor be part
+		// of an HTML entity ("&#123;")
+		start := m[0]
+		if m[4] >= 0 {
+			start = m[4]
+		}
+		if start > 0 && isIssueRefBoundary(line[start-1]) {
+			return model.IssueRef{}, false
+		}
+		ref.Repository = group(2)
+		ref.ID = group(3)
+	case m[8] >= 0:
+		ref.ID = group(4)
+	default:
+		key := group(5)
+		if notIssueKeys[key[:strings.Index(key, "-")]] {
+			return model.IssueRef{}, false
+		}
+		// version numbers and dates (CVE-2015-1234, X-1.2)
+		if end := m[1]; end+1 < len(line) && (line[end] == '-' || line[end] == '.') &&
+			line[end+1] >= '0' && line[end+1] <= '9' {
+			return model.IssueRef{}, false
+		}
+		ref.ID = key
+	}
+
+	return ref, true
+}
+
+// isIssueRefBoundary returns true if c may not precede an issue reference.
+func isIssueRefBoundary(c byte) bool {
+	return c == '&' || c == '/' || c == '_' ||
+		(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
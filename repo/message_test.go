@@ -0,0 +1,188 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DevMine/repotool/model"
+)
+
+func TestParseTrailers(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    []model.Trailer
+	}{
+		{name: "empty"},
+		{
+			name:    "subject only",
+			message: "Signed-off-by: Jane Doe <jane@example.org>",
+		},
+		{
+			name:    "trailers",
+			message: "Fix the frobnicator\n\nIt was broken.\n\nSigned-off-by: Jane Doe <jane@example.org>\nReviewed-by: John Doe <john@example.org>\n",
+			want: []model.Trailer{
+				{Key: "Signed-off-by", Value: "Jane Doe <jane@example.org>"},
+				{Key: "Reviewed-by", Value: "John Doe <john@example.org>"},
+			},
+		},
+		{
+			name:    "continuation line",
+			message: "Fix it\n\nCo-authored-by: Jane Doe\n  <jane@example.org>\nBug: 42",
+			want: []model.Trailer{
+				{Key: "Co-authored-by", Value: "Jane Doe <jane@example.org>"},
+				{Key: "Bug", Value: "42"},
+			},
+		},
+		{
+			name:    "last paragraph is not only trailers",
+			message: "Fix it\n\nNote: this is a sentence\nwhich goes on.",
+		},
+		{
+			name:    "git trailer along with other lines",
+			message: "Fix it\n\nSigned-off-by: Jane Doe <jane@example.org>\n[jd: rebased]\nAcked-by: John Doe <john@example.org>",
+			want: []model.Trailer{
+				{Key: "Signed-off-by", Value: "Jane Doe <jane@example.org>"},
+				{Key: "Acked-by", Value: "John Doe <john@example.org>"},
+			},
+		},
+		{
+			name:    "git trailer with too many other lines",
+			message: "Fix it\n\nSigned-off-by: Jane Doe <jane@example.org>\na\nb\nc\nd",
+		},
+		{
+			name:    "trailers in the middle of the message",
+			message: "Fix it\n\nBug: 42\n\nSome more explanations.",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := parseTrailers(tt.message); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCoAuthors(t *testing.T) {
+	trailers := []model.Trailer{
+		{Key: "Co-authored-by", Value: "Jane Doe <jane@example.org>"},
+		{Key: "CO-AUTHORED-BY", Value: "John Doe <john@example.org>"},
+		{Key: "Co-authored-by", Value: "nobody"},
+		{Key: "Co-authored-by", Value: "<anonymous@example.org>"},
+		{Key: "Signed-off-by", Value: "Jane Roe <jane.roe@example.org>"},
+	}
+
+	want := []model.Developer{
+		{Name: "Jane Doe", Email: "jane@example.org"},
+		{Name: "John Doe", Email: "john@example.org"},
+	}
+	if got := coAuthors(trailers); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		message string
+		subject string
+		body    string
+	}{
+		{"", "", ""},
+		{"Fix it", "Fix it", ""},
+		{"Fix it\n", "Fix it", ""},
+		{"\n\nFix it\n\nBecause.\n", "Fix it", "Because."},
+		{"Fix it\nfor good\n\n\nBecause.\n\nReally.\n\n", "Fix it for good", "Because.\n\nReally."},
+	}
+
+	for _, tt := range tests {
+		subject, body := splitMessage(tt.message)
+		if subject != tt.subject || body != tt.body {
+			t.Errorf("splitMessage(%q) = %q, %q, want %q, %q", tt.message, subject, body, tt.subject, tt.body)
+		}
+	}
+}
+
+func TestParseIssueRefs(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []model.IssueRef
+	}{
+		{"Fix the frobnicator", nil},
+		{
+			"Fixes #12",
+			[]model.IssueRef{{Ref: "#12", Keyword: "fixes", ID: "12"}},
+		},
+		{
+			"Closes: DevMine/repotool#3",
+			[]model.IssueRef{{Ref: "DevMine/repotool#3", Keyword: "closes", Repository: "DevMine/repotool", ID: "3"}},
+		},
+		{
+			"fixes #1, #2 and #3, see #4",
+			[]model.IssueRef{
+				{Ref: "#1", Keyword: "fixes", ID: "1"},
+				{Ref: "#2", Keyword: "fixes", ID: "2"},
+				{Ref: "#3", Keyword: "fixes", ID: "3"},
+				{Ref: "#4", Keyword: "see", ID: "4"},
+			},
+		},
+		{
+			"Related to #1 but not to this #2",
+			[]model.IssueRef{
+				{Ref: "#1", Keyword: "related to", ID: "1"},
+				{Ref: "#2", ID: "2"},
+			},
+		},
+		{
+			"GH-123 and PROJ-456",
+			[]model.IssueRef{
+				{Ref: "GH-123", ID: "123"},
+				{Ref: "PROJ-456", ID: "PROJ-456"},
+			},
+		},
+		{
+			"Resolves https://github.com/DevMine/repotool/issues/7.",
+			[]model.IssueRef{{
+				Ref:        "https://github.com/DevMine/repotool/issues/7",
+				Keyword:    "resolves",
+				Repository: "DevMine/repotool",
+				ID:         "7",
+				URL:        "https://github.com/DevMine/repotool/issues/7",
+			}},
+		},
+		{
+			"See https://gitlab.com/group/sub/project/-/merge_requests/5",
+			[]model.IssueRef{{
+				Ref:        "https://gitlab.com/group/sub/project/-/merge_requests/5",
+				Keyword:    "see",
+				Repository: "group/sub/project",
+				ID:         "5",
+				URL:        "https://gitlab.com/group/sub/project/-/merge_requests/5",
+			}},
+		},
+		{
+			"Refs https://jira.example.org/browse/PROJ-9",
+			[]model.IssueRef{{
+				Ref:     "https://jira.example.org/browse/PROJ-9",
+				Keyword: "refs",
+				ID:      "PROJ-9",
+				URL:     "https://jira.example.org/browse/PROJ-9",
+			}},
+		},
+		// not issue references
+		{"Read https://example.org/docs/1", nil},
+		{"Support C#1 and &#123;", nil},
+		{"Use UTF-8 and SHA-1, see RFC-2616", nil},
+		{"Fix CVE-2015-1234", nil},
+		{"Bump X-1.2", nil},
+	}
+
+	for _, tt := range tests {
+		if got := parseIssueRefs(tt.message); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIssueRefs(%q) = %+v, want %+v", tt.message, got, tt.want)
+		}
+	}
+}
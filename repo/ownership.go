@@ -0,0 +1,464 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	g2g "github.com/libgit2/git2go"
+
+	"github.com/DevMine/repotool/model"
+)
+
+const (
+	// binaryCheckSize is the number of bytes of a file looked at to tell
+	// whether it is binary, as git does.
+	binaryCheckSize = 8000
+
+	// maxIgnoredRevsDepth is the maximum number of ignored revisions a line
+	// is traced through.
+	maxIgnoredRevsDepth = 10
+)
+
+// blameLine tells which commit a line was last changed by.
+type blameLine struct {
+	commit string
+	dev    model.Developer
+
+	// path and number of the line in the commit
+	path string
+	line int
+}
+
+// blameKey identifies the blame of a file at a given commit.
+type blameKey struct {
+	path   string
+	commit string
+}
+
+// ownershipBlamer blames the files of a repository.
+type ownershipBlamer struct {
+	gr      *gitRepo
+	ignored map[string]bool
+	cache   map[blameKey][]blameLine
+}
+
+// FetchOwnership blames every text file of the tree HEAD points to and
+// computes the share of each file, and of each directory, written by each
+// developer. Commits listed in the ignore revisions file, if any, are skipped
+// over: the lines they changed are attributed to the commits which
+// previously changed them.
+func (gr *gitRepo) FetchOwnership() error {
+	headID, tfs, err := gr.headTextFiles()
+	if err != nil {
+		return err
+	}
+
+	ignored, err := gr.readIgnoreRevs()
+	if err != nil {
+		return err
+	}
+	b := &ownershipBlamer{gr: gr, ignored: ignored, cache: make(map[blameKey][]blameLine)}
+
+	files := make(map[string]map[string]*model.Owner)
+	for _, tf := range tfs {
+		lines, err := b.blame(tf.path, headID, 0)
+		if err != nil {
+			return err
+		}
+		files[tf.path] = lineOwners(lines)
+	}
+
+	gr.Ownership = &model.Ownership{
+		Commit:      gr.HeadCommit,
+		Files:       pathOwnerships(files),
+		Directories: pathOwnerships(dirOwners(files)),
+	}
+	if gr.anonymizer != nil {
+		gr.anonymizer.Ownership(gr.Ownership)
+	}
+
+	return nil
+}
+
+// treeFile is a file of a tree.
+type treeFile struct {
+	path string
+	id   *g2g.Oid
+}
+
+// headTextFiles returns the ID of the commit HEAD points to and the text
+// files of its tree, as textFiles does. Empty repositories have no files.
+func (gr *gitRepo) headTextFiles() (*g2g.Oid, []treeFile, error) {
+	if len(gr.HeadCommit) == 0 {
+		return nil, nil, nil
+	}
+
+	headID, err := g2g.NewOid(gr.HeadCommit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tfs, err := gr.textFiles(headID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return headID, tfs, nil
+}
+
+// textFiles returns the text files of the tree of a commit, sorted by path.
+// Symbolic links, submodules and files left out by the path filter are
+// ignored.
+func (gr *gitRepo) textFiles(commitID *g2g.Oid) ([]treeFile, error) {
+	commit, err := gr.r.LookupCommit(commitID)
+	if err != nil {
+		return nil, err
+	}
+	defer commit.Free()
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Free()
+
+	pf := pathFilter{include: gr.cfg.IncludePaths, exclude: gr.cfg.ExcludePaths}
+
+	var files []treeFile
+	err = tree.Walk(func(dir string, entry *g2g.TreeEntry) int {
+		if entry.Filemode != g2g.FilemodeBlob && entry.Filemode != g2g.FilemodeBlobExecutable {
+			return 0
+		}
+
+		p := dir + entry.Name
+		if !pf.isEmpty() && !pf.keep(p) {
+			return 0
+		}
+
+		if bytes.IndexByte(gr.blobContent(entry.Id, binaryCheckSize), 0) >= 0 {
+			// binary file
+			return 0
+		}
+
+		files = append(files, treeFile{path: p, id: entry.Id})
+		return 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(treeFilesByPath(files))
+	return files, nil
+}
+
+// blame returns, for each line of the file found at p in the commit newest,
+// the commit it was last changed by. Lines changed by ignored commits are
+// traced back to the commits which previously changed them, up to
+// maxIgnoredRevsDepth ignored commits.
+func (b *ownershipBlamer) blame(p string, newest *g2g.Oid, depth int) ([]blameLine, error) {
+	key := blameKey{path: p, commit: newest.String()}
+	if lines, ok := b.cache[key]; ok {
+		return lines, nil
+	}
+
+	opts, err := g2g.DefaultBlameOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.NewestCommit = newest
+
+	blame, err := b.gr.r.BlameFile(p, &opts)
+	if err != nil {
+		return nil, err
+	}
+	defer blame.Free()
+
+	var lines []blameLine
+	for i := 0; i < blame.HunkCount(); i++ {
+		hunk, err := blame.HunkByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+
+		origPath := hunk.OrigPath
+		if len(origPath) == 0 {
+			origPath = p
+		}
+		var dev model.Developer
+		if sig := hunk.FinalSignature; sig != nil {
+			dev = b.gr.mailmap.developer(sig.Name, sig.Email)
+		}
+		for j := 0; j < int(hunk.LinesInHunk); j++ {
+			lines = append(lines, blameLine{
+				commit: hunk.FinalCommitId.String(),
+				dev:    dev,
+				path:   origPath,
+				line:   int(hunk.OrigStartLineNumber) + j,
+			})
+		}
+	}
+
+	if len(b.ignored) > 0 && depth < maxIgnoredRevsDepth {
+		if err := b.skipIgnored(lines, depth); err != nil {
+			return nil, err
+		}
+	}
+
+	b.cache[key] = lines
+	return lines, nil
+}
+
+// skipIgnored attributes the lines last changed by ignored commits to the
+// commits which changed them before, when they can be found.
+func (b *ownershipBlamer) skipIgnored(lines []blameLine, depth int) error {
+	for i, l := range lines {
+		if !b.ignored[l.commit] {
+			continue
+		}
+
+		commitID, err := g2g.NewOid(l.commit)
+		if err != nil {
+			return err
+		}
+		commit, err := b.gr.r.LookupCommit(commitID)
+		if err != nil {
+			return err
+		}
+		if commit.ParentCount() == 0 {
+			commit.Free()
+			continue
+		}
+		parentID := commit.ParentId(0)
+		commit.Free()
+
+		oldPath, oldLine, err := b.gr.previousLine(parentID, commitID, l.path, l.line)
+		if err != nil {
+			return err
+		}
+		if oldLine == 0 {
+			// the line was added by the ignored commit
+			continue
+		}
+
+		parentLines, err := b.blame(oldPath, parentID, depth+1)
+		if err != nil {
+			return err
+		}
+		if oldLine <= len(parentLines) {
+			lines[i] = parentLines[oldLine-1]
+		}
+	}
+
+	return nil
+}
+
+// previousLine returns the path and number, in the parent commit, of the
+// line found at p:line in a commit, this line having been changed by the
+// commit. As git blame does when ignoring revisions, changed lines are
+// matched with the line found at the same offset in the hunk of the parent,
+// if any. It returns a 0 line number if the line cannot be matched, as is the
+// case for lines added by the commit.
+func (gr *gitRepo) previousLine(parentID, commitID *g2g.Oid, p string, line int) (string, int, error) {
+	parent, err := gr.r.LookupCommit(parentID)
+	if err != nil {
+		return "", 0, err
+	}
+	defer parent.Free()
+
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return "", 0, err
+	}
+	defer parentTree.Free()
+
+	commit, err := gr.r.LookupCommit(commitID)
+	if err != nil {
+		return "", 0, err
+	}
+	defer commit.Free()
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", 0, err
+	}
+	defer tree.Free()
+
+	opts, err := g2g.DefaultDiffOptions()
+	if err != nil {
+		return "", 0, err
+	}
+	opts.Pathspec = []string{p}
+
+	diff, err := gr.r.DiffTreeToTree(parentTree, tree, &opts)
+	if err != nil {
+		return "", 0, err
+	}
+	defer diff.Free()
+
+	var oldPath string
+	var oldLine int
+	err = diff.ForEach(func(delta g2g.DiffDelta, _ float64) (g2g.DiffForEachHunkCallback, error) {
+		if delta.NewFile.Path != p || delta.Status == g2g.DeltaAdded {
+			return nil, nil
+		}
+		oldPath = delta.OldFile.Path
+
+		return func(hunk g2g.DiffHunk) (g2g.DiffForEachLineCallback, error) {
+			if line < hunk.NewStart || line >= hunk.NewStart+hunk.NewLines || hunk.OldLines == 0 {
+				return nil, nil
+			}
+			offset := line - hunk.NewStart
+			if offset >= hunk.OldLines {
+				offset = hunk.OldLines - 1
+			}
+			oldLine = hunk.OldStart + offset
+			return nil, nil
+		}, nil
+	}, g2g.DiffDetailHunks)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return oldPath, oldLine, nil
+}
+
+// readIgnoreRevs reads the ignore revisions file given in the configuration,
+// if any, and returns the set of the IDs of the commits it lists. Relative
+// paths are looked up in the tree HEAD points to, as is the case for
+// .git-blame-ignore-revs.
+func (gr *gitRepo) readIgnoreRevs() (map[string]bool, error) {
+	p := gr.cfg.IgnoreRevsFile
+	if len(p) == 0 {
+		return nil, nil
+	}
+
+	var content []byte
+	var err error
+	if filepath.IsAbs(p) {
+		content, err = ioutil.ReadFile(p)
+	} else {
+		content, err = headFileContent(gr.r, filepath.ToSlash(p))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ignored := make(map[string]bool)
+	for n, line := range strings.Split(string(content), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		oid, err := g2g.NewOid(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid revision %q", p, n+1, line)
+		}
+		ignored[oid.String()] = true
+	}
+
+	return ignored, nil
+}
+
+// lineOwners returns the owners of the lines of a file, mapped by lowercased
+// canonical email.
+func lineOwners(lines []blameLine) map[string]*model.Owner {
+	owners := make(map[string]*model.Owner)
+	for _, l := range lines {
+		key := strings.ToLower(l.dev.CanonicalEmail)
+		o, ok := owners[key]
+		if !ok {
+			o = &model.Owner{Developer: l.dev}
+			owners[key] = o
+		}
+		o.Lines++
+	}
+	return owners
+}
+
+// dirOwners aggregates the owners of files, mapped by path, into the owners
+// of the directories containing them, recursively, up to the root directory
+// ".".
+func dirOwners(files map[string]map[string]*model.Owner) map[string]map[string]*model.Owner {
+	dirs := make(map[string]map[string]*model.Owner)
+	for p, owners := range files {
+		for dir := path.Dir(p); ; dir = path.Dir(dir) {
+			if _, ok := dirs[dir]; !ok {
+				dirs[dir] = make(map[string]*model.Owner)
+			}
+			for key, o := range owners {
+				do, ok := dirs[dir][key]
+				if !ok {
+					do = &model.Owner{Developer: o.Developer}
+					dirs[dir][key] = do
+				}
+				do.Lines += o.Lines
+			}
+			if dir == "." {
+				break
+			}
+		}
+	}
+	return dirs
+}
+
+// pathOwnerships converts owners mapped by path to a list of path
+// ownerships, sorted by path, whose owners are sorted by decreasing number
+// of lines.
+func pathOwnerships(paths map[string]map[string]*model.Owner) []model.PathOwnership {
+	pos := make([]model.PathOwnership, 0, len(paths))
+	for p, owners := range paths {
+		po := model.PathOwnership{Path: p}
+		for _, o := range owners {
+			po.Lines += o.Lines
+			po.Owners = append(po.Owners, *o)
+		}
+		for i := range po.Owners {
+			po.Owners[i].Share = float64(po.Owners[i].Lines) / float64(po.Lines)
+		}
+		sort.Sort(ownersByLines(po.Owners))
+		pos = append(pos, po)
+	}
+
+	sort.Sort(pathOwnershipsByPath(pos))
+	return pos
+}
+
+// ownersByLines implements sort.Interface to sort owners by decreasing
+// number of lines, then by email.
+type ownersByLines []model.Owner
+
+func (o ownersByLines) Len() int      { return len(o) }
+func (o ownersByLines) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+func (o ownersByLines) Less(i, j int) bool {
+	if o[i].Lines != o[j].Lines {
+		return o[i].Lines > o[j].Lines
+	}
+	return o[i].Developer.CanonicalEmail < o[j].Developer.CanonicalEmail
+}
+
+// pathOwnershipsByPath implements sort.Interface to sort path ownerships by
+// path.
+type pathOwnershipsByPath []model.PathOwnership
+
+func (p pathOwnershipsByPath) Len() int           { return len(p) }
+func (p pathOwnershipsByPath) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p pathOwnershipsByPath) Less(i, j int) bool { return p[i].Path < p[j].Path }
+
+// treeFilesByPath implements sort.Interface to sort tree files by path.
+type treeFilesByPath []treeFile
+
+func (t treeFilesByPath) Len() int           { return len(t) }
+func (t treeFilesByPath) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t treeFilesByPath) Less(i, j int) bool { return t[i].path < t[j].path }
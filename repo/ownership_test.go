@@ -0,0 +1,80 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/DevMine/repotool/model"
+)
+
+func TestOwnership(t *testing.T) {
+	jane := model.Developer{Name: "Jane Doe", Email: "jane@laptop", CanonicalName: "Jane Doe", CanonicalEmail: "jane@example.org"}
+	janeToo := model.Developer{Name: "jd", Email: "jd@laptop", CanonicalName: "Jane Doe", CanonicalEmail: "Jane@Example.org"}
+	john := model.Developer{Name: "John Doe", Email: "john@example.org", CanonicalName: "John Doe", CanonicalEmail: "john@example.org"}
+
+	blame := func(devs ...model.Developer) []blameLine {
+		var lines []blameLine
+		for i, d := range devs {
+			lines = append(lines, blameLine{commit: "c", dev: d, line: i + 1})
+		}
+		return lines
+	}
+	files := map[string]map[string]*model.Owner{
+		"README":       lineOwners(blame(jane, janeToo, jane)),
+		"LICENSE":      lineOwners(blame(john, jane)),
+		"src/a.go":     lineOwners(blame(john, jane, john, john)),
+		"src/pkg/b.go": lineOwners(blame(john, john)),
+	}
+
+	wantFiles := []model.PathOwnership{
+		{Path: "LICENSE", Lines: 2, Owners: []model.Owner{
+			{Developer: jane, Lines: 1, Share: 0.5},
+			{Developer: john, Lines: 1, Share: 0.5},
+		}},
+		{Path: "README", Lines: 3, Owners: []model.Owner{
+			{Developer: jane, Lines: 3, Share: 1},
+		}},
+		{Path: "src/a.go", Lines: 4, Owners: []model.Owner{
+			{Developer: john, Lines: 3, Share: 0.75},
+			{Developer: jane, Lines: 1, Share: 0.25},
+		}},
+		{Path: "src/pkg/b.go", Lines: 2, Owners: []model.Owner{
+			{Developer: john, Lines: 2, Share: 1},
+		}},
+	}
+	if got := pathOwnerships(files); !reflect.DeepEqual(got, wantFiles) {
+		t.Errorf("files: got %+v, want %+v", got, wantFiles)
+	}
+
+	wantDirs := []model.PathOwnership{
+		{Path: ".", Lines: 11, Owners: []model.Owner{
+			{Developer: john, Lines: 6, Share: float64(6) / 11},
+			{Developer: jane, Lines: 5, Share: float64(5) / 11},
+		}},
+		{Path: "src", Lines: 6, Owners: []model.Owner{
+			{Developer: john, Lines: 5, Share: float64(5) / 6},
+			{Developer: jane, Lines: 1, Share: float64(1) / 6},
+		}},
+		{Path: "src/pkg", Lines: 2, Owners: []model.Owner{
+			{Developer: john, Lines: 2, Share: 1},
+		}},
+	}
+	if got := pathOwnerships(dirOwners(files)); !reflect.DeepEqual(got, wantDirs) {
+		t.Errorf("directories: got %+v, want %+v", got, wantDirs)
+	}
+
+	// aggregating must not change the owners of files
+	if files["README"]["jane@example.org"].Lines != 3 {
+		t.Errorf("README: got %+v", files["README"]["jane@example.org"])
+	}
+}
+
+func TestOwnershipNoFiles(t *testing.T) {
+	if got := pathOwnerships(dirOwners(nil)); got == nil || len(got) != 0 {
+		t.Errorf("got %#v, want an empty list", got)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"path"
+	"strings"
+)
+
+// pathFilter decides which files are taken into account when computing the
+// changes made by a commit, based on include and exclude patterns.
+//
+// Patterns follow a subset of the gitignore syntax: a pattern ending with a
+// slash (vendor/) matches a directory and everything below it, a pattern
+// without any slash (*.min.js) is matched against the file name only and
+// any other pattern (src/*.go) is matched against the whole path, relative to
+// the repository root. A leading slash anchors a pattern to the repository
+// root. Wildcards are the ones understood by path.Match.
+// Unlike in gitignore files, a pattern without any slash only matches files:
+// vendor does not match the vendor directory, vendor/ does.
+type pathFilter struct {
+	include []string
+	exclude []string
+}
+
+// isEmpty returns true if the filter lets every file through.
+func (pf pathFilter) isEmpty() bool {
+	return len(pf.include) == 0 && len(pf.exclude) == 0
+}
+
+// keep returns true if the file at path p shall be taken into account, ie
+// if it matches one of the include patterns, if any, and none of the exclude
+// patterns.
+func (pf pathFilter) keep(p string) bool {
+	if len(pf.include) > 0 && !matchAnyPathPattern(pf.include, p) {
+		return false
+	}
+
+	return !matchAnyPathPattern(pf.exclude, p)
+}
+
+func matchAnyPathPattern(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if matchPathPattern(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPattern returns true if the path p matches pattern. See pathFilter
+// for the pattern syntax.
+func matchPathPattern(pattern, p string) bool {
+	// as in gitignore files, a leading slash anchors the pattern to the root
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	comps := strings.Split(p, "/")
+
+	if strings.HasSuffix(pattern, "/") {
+		dir := strings.TrimSuffix(pattern, "/")
+		if anchored || strings.Contains(dir, "/") {
+			return matchPrefix(dir, comps)
+		}
+		// the last component is the file itself
+		for _, c := range comps[:len(comps)-1] {
+			if ok, _ := path.Match(dir, c); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !anchored && !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+
+	if ok, _ := path.Match(pattern, p); ok {
+		return true
+	}
+	// a pattern matching a directory matches everything below it
+	return matchPrefix(pattern, comps)
+}
+
+// matchPrefix returns true if the path pattern matches the first components
+// of a path, the path having more components than the pattern.
+func matchPrefix(pattern string, comps []string) bool {
+	n := strings.Count(pattern, "/") + 1
+	if n >= len(comps) {
+		return false
+	}
+	ok, _ := path.Match(pattern, strings.Join(comps[:n], "/"))
+	return ok
+}
@@ -0,0 +1,83 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import "testing"
+
+func TestMatchPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		// directories, anywhere in the tree
+		{"vendor/", "vendor/foo.go", true},
+		{"vendor/", "src/vendor/github.com/foo/bar.go", true},
+		{"vendor/", "vendor", false},
+		{"vendor/", "src/vendor.go", false},
+		{"vend*/", "vendored/foo.go", true},
+
+		// a bare name only matches files
+		{"vendor", "vendor", true},
+		{"vendor", "src/vendor", true},
+		{"vendor", "vendor/foo.go", false},
+
+		// anchored patterns
+		{"/docs", "docs/index.md", true},
+		{"/docs", "docs", true},
+		{"/docs", "src/docs/index.md", false},
+		{"/docs/", "docs/api/index.md", true},
+		{"/docs/", "src/docs/index.md", false},
+
+		// file names
+		{"*.min.js", "app.min.js", true},
+		{"*.min.js", "static/js/app.min.js", true},
+		{"*.min.js", "app.js", false},
+
+		// whole paths
+		{"src/*.go", "src/main.go", true},
+		{"src/*.go", "src/pkg/main.go", false},
+		{"src/*.go", "lib/src/main.go", false},
+		{"src/pkg", "src/pkg/main.go", true},
+		{"src/pkg/", "src/pkg/sub/main.go", true},
+		{"src/*/", "src/pkg/main.go", true},
+		{"src/*/", "src/main.go", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchPathPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPathPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPathFilterKeep(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter pathFilter
+		path   string
+		want   bool
+	}{
+		{"empty", pathFilter{}, "vendor/foo.go", true},
+		{"excluded", pathFilter{exclude: []string{"vendor/", "*.min.js"}}, "vendor/foo.go", false},
+		{"not excluded", pathFilter{exclude: []string{"vendor/", "*.min.js"}}, "src/app.js", true},
+		{"included", pathFilter{include: []string{"src/"}}, "src/app.js", true},
+		{"not included", pathFilter{include: []string{"src/"}}, "docs/index.md", false},
+		{"included then excluded", pathFilter{include: []string{"src/"}, exclude: []string{"*.min.js"}}, "src/app.min.js", false},
+		{"included and not excluded", pathFilter{include: []string{"src/"}, exclude: []string{"*.min.js"}}, "src/app.js", true},
+		{"excluded but not included", pathFilter{include: []string{"src/"}, exclude: []string{"*.min.js"}}, "app.min.js", false},
+		{"any include", pathFilter{include: []string{"/docs", "*.go"}}, "cmd/main.go", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.filter.keep(tt.path); got != tt.want {
+			t.Errorf("%s: keep(%q) = %v, want %v", tt.name, tt.path, got, tt.want)
+		}
+	}
+
+	if !(pathFilter{}).isEmpty() || (pathFilter{exclude: []string{"vendor/"}}).isEmpty() {
+		t.Error("isEmpty: wrong result")
+	}
+}
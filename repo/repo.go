@@ -6,9 +6,7 @@
 package repo
 
 import (
-	"archive/tar"
 	"errors"
-	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -50,15 +48,46 @@ type Repo interface {
 	// GetCloneURL returns the clone URL of a repo.
 	GetCloneURL() string
 
+	// GetRemotes returns the remotes of a repo.
+	GetRemotes() []model.Remote
+
 	// GetClonePath returns the clone path of a repo.
 	GetClonePath() string
 
 	// GetDefaultBranch returns the default branch of a repo.
 	GetDefaultBranch() string
 
+	// GetHeadCommit returns the ID of the commit HEAD of a repo points to.
+	GetHeadCommit() string
+
 	// GetCommits returns the list of commits of a repo.
 	GetCommits() []model.Commit
 
+	// GetFiles returns the list of files touched by the commits of a repo,
+	// tracked across renames and copies.
+	GetFiles() []model.File
+
+	// GetFileHistory returns the history of the file found at a given path,
+	// or of the files which were found there at some point.
+	GetFileHistory(path string) *model.FileHistory
+
+	// FetchTags populates Tags attribute with all tags of a repository.
+	FetchTags() error
+
+	// GetTags returns the list of tags of a repo.
+	GetTags() []model.Tag
+
+	// FetchOwnership computes the ownership of the files of the tree HEAD
+	// points to.
+	FetchOwnership() error
+
+	// GetOwnership returns the ownership of the files of a repo.
+	GetOwnership() *model.Ownership
+
+	// CountLines returns the number of lines of each text file of the tree
+	// HEAD points to, by path.
+	CountLines() (map[string]int, error)
+
 	// Cleanup needs to be called when done using the repository. It performs
 	// some housekeeping if necessary.
 	Cleanup() error
@@ -70,7 +99,7 @@ var _ Repo = (*gitRepo)(nil)
 func New(cfg config.DataConfig, path string) (Repo, error) {
 	var repo Repo
 
-	vcs, err := detectVCS(path)
+	vcs, gitDir, err := detectVCS(path)
 	if err != nil {
 		return nil, err
 	}
@@ -78,6 +107,7 @@ func New(cfg config.DataConfig, path string) (Repo, error) {
 	switch vcs {
 	case Git:
 		var useTmpDir bool
+		var objects *tarObjects
 		tmpPath := path
 		if strings.HasSuffix(path, ".tar") {
 			if fi, err := os.Stat(path); err == nil && (bytesToGigaBytes(fi.Size()) < cfg.TmpDirFileSizeLimit) {
@@ -89,7 +119,18 @@ func New(cfg config.DataConfig, path string) (Repo, error) {
 				tmpPath = strings.TrimSuffix(tmpPath, ".tar")
 			}
 
-			if err = untarGitFolder(tmpPath, path); err != nil {
+			if cfg.TarObjects {
+				objects, err = openTarObjects(path, gigaBytesToBytes(cfg.TarFileSizeLimit))
+				if err != nil {
+					_ = os.RemoveAll(tmpPath)
+					return nil, err
+				}
+			}
+
+			if err = untarGitFolder(cfg, tmpPath, path, gitDir, objects); err != nil {
+				if objects != nil {
+					_ = objects.Close()
+				}
 				_ = os.RemoveAll(tmpPath)
 				return nil, err
 			}
@@ -100,25 +141,25 @@ func New(cfg config.DataConfig, path string) (Repo, error) {
 			// temporary directory
 			useTmpDir = true
 		}
-		cloneURL, err := extractGitURL(tmpPath)
-		if err != nil {
-			return nil, err
-		}
-
-		branch, err := extractGitDefaultBranch(tmpPath)
-		if err != nil {
-			return nil, err
-		}
-
 		repository := model.Repository{
-			Name:          extractName(path),
-			VCS:           vcs,
-			CloneURL:      *cloneURL,
-			ClonePath:     path,
-			DefaultBranch: *branch,
+			Name:      extractName(path),
+			VCS:       vcs,
+			ClonePath: path,
+		}
+		if useTmpDir {
+			repository.ArchiveGitDir = strings.TrimSuffix(gitDir, "/")
+			if len(repository.ArchiveGitDir) == 0 {
+				repository.ArchiveGitDir = "."
+			}
 		}
-		repo, err = newGitRepo(cfg, repository, tmpPath, useTmpDir)
+		repo, err = newGitRepo(cfg, repository, tmpPath, useTmpDir, objects)
 		if err != nil {
+			if objects != nil {
+				_ = objects.Close()
+			}
+			if useTmpDir {
+				_ = os.RemoveAll(tmpPath)
+			}
 			return nil, err
 		}
 
@@ -130,49 +171,26 @@ func New(cfg config.DataConfig, path string) (Repo, error) {
 
 // detectVCS attempts at detecting the VCS of the repository. It can take
 // either a directory or a tar archive version of a repository as argument.
-func detectVCS(path string) (string, error) {
+// It also returns the location of the VCS directory: for tar archives, it is
+// relative to the archive root (see findArchiveGitDir).
+func detectVCS(path string) (string, string, error) {
 	// check tar archive case
 	if strings.HasSuffix(path, ".tar") {
-		archiveFile, err := os.Open(path)
+		gitDir, ok, err := findArchiveGitDir(path)
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
-		defer archiveFile.Close()
-
-		// only the relative path shall be stored in the archive
-		path = filepath.Base(strings.TrimSuffix(path, ".tar"))
-
-		tr := tar.NewReader(archiveFile)
-
-		for {
-			hdr, err := tr.Next()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return "", err
-			}
-
-			mode := hdr.FileInfo().Mode()
-			if mode&os.ModeDir != 0 {
-				// remove trailing /, if any
-				dir := strings.TrimSuffix(hdr.Name, "/")
-				switch dir {
-				// is it a git repository?
-				// (only the archive root's .git directory is valid for the check)
-				case filepath.Join(path, ".git"):
-					return Git, nil
-				}
-			}
+		if ok {
+			return Git, gitDir, nil
 		}
 	} else {
-		// is it a git repository?
-		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
-			return Git, nil
+		// is it a git repository? (either a working directory or a bare one)
+		if gitDir, err := discoverGitDir(path); err == nil {
+			return Git, gitDir, nil
 		}
 	}
 
-	return "", errors.New("VCS type not found")
+	return "", "", errors.New("VCS type not found")
 }
 
 // isCommitValid checks whether a commit is valid, ie strings are full UTF-8, etc.
@@ -219,10 +237,15 @@ func isDeveloperValid(d model.Developer) bool {
 }
 
 // extractName extracts to name of a repository given its clone URL.
+// The .git extension of bare repositories is removed.
 func extractName(path string) string {
-	return filepath.Base(path)
+	return strings.TrimSuffix(filepath.Base(path), ".git")
 }
 
 func bytesToGigaBytes(bytes int64) float64 {
 	return float64(bytes) / 1000000000.0
 }
+
+func gigaBytesToBytes(gb float64) int64 {
+	return int64(gb * 1000000000.0)
+}
@@ -0,0 +1,433 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"strings"
+
+	g2g "github.com/libgit2/git2go"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/DevMine/repotool/config"
+	"github.com/DevMine/repotool/model"
+)
+
+// signatureHeaders are the headers of commit objects holding a signature.
+var signatureHeaders = []string{"gpgsig", "gpgsig-sha256"}
+
+// signatureArmors maps the first line of armored signatures to the type of
+// the signature.
+var signatureArmors = map[string]string{
+	"-----BEGIN PGP SIGNATURE-----":  model.SignatureGPG,
+	"-----BEGIN SSH SIGNATURE-----":  model.SignatureSSH,
+	"-----BEGIN SIGNED MESSAGE-----": model.SignatureX509,
+}
+
+const (
+	// sshSigMagic is the magic preamble of SSH signatures.
+	sshSigMagic = "SSHSIG"
+
+	// sshSigNamespace is the namespace of the SSH signatures made by git.
+	sshSigNamespace = "git"
+)
+
+// sshSignature is an SSH signature, as defined by the PROTOCOL.sshsig file
+// of OpenSSH.
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// allowedSigner is an entry of an SSH allowed signers file: a public key
+// and the principals (email patterns) it may sign for.
+type allowedSigner struct {
+	principals string
+	key        ssh.PublicKey
+}
+
+// signatureVerifier verifies signatures against an OpenPGP keyring and SSH
+// allowed signers.
+type signatureVerifier struct {
+	checkGPG bool
+	keyring  openpgp.EntityList
+
+	checkSSH       bool
+	allowedSigners []allowedSigner
+}
+
+// newSignatureVerifier creates a signature verifier using the keyring and
+// the allowed signers file given in the configuration, if any.
+func newSignatureVerifier(cfg config.DataConfig) (*signatureVerifier, error) {
+	sv := new(signatureVerifier)
+
+	if len(cfg.GPGKeyring) > 0 {
+		keyring, err := readKeyring(cfg.GPGKeyring)
+		if err != nil {
+			return nil, err
+		}
+		sv.checkGPG = true
+		sv.keyring = keyring
+	}
+
+	if len(cfg.SSHAllowedSigners) > 0 {
+		signers, err := readAllowedSigners(cfg.SSHAllowedSigners)
+		if err != nil {
+			return nil, err
+		}
+		sv.checkSSH = true
+		sv.allowedSigners = signers
+	}
+
+	return sv, nil
+}
+
+// commitSignature returns the signature of the commit whose ID is oid, or
+// nil if the commit is not signed. The signature is verified if a keyring or
+// allowed signers were provided for its type, SSH signatures being checked
+// against the email of the committer.
+func (gr *gitRepo) commitSignature(oid *g2g.Oid, committerEmail string) (*model.Signature, error) {
+	obj, err := gr.odb.Read(oid)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Free()
+
+	sig, signed := splitSignature(obj.Data())
+	if sig == nil {
+		return nil, nil
+	}
+
+	s := &model.Signature{Type: signatureType(sig), Raw: string(sig)}
+	switch s.Type {
+	case model.SignatureGPG:
+		s.KeyID = gpgKeyID(sig)
+		if gr.verifier.checkGPG {
+			s.Status = verifyGPG(gr.verifier.keyring, sig, signed)
+		}
+	case model.SignatureSSH:
+		sshSig, err := parseSSHSignature(sig)
+		if err != nil {
+			if gr.verifier.checkSSH {
+				s.Status = model.SignatureBad
+			}
+			break
+		}
+		if pub, err := ssh.ParsePublicKey(sshSig.PublicKey); err == nil {
+			s.KeyID = ssh.FingerprintSHA256(pub)
+		}
+		if gr.verifier.checkSSH {
+			s.Status = verifySSH(gr.verifier.allowedSigners, committerEmail, sshSig, signed)
+		}
+	}
+
+	return s, nil
+}
+
+// splitSignature extracts the signature of a raw commit object. It returns
+// the signature and the signed data, that is the object without its
+// signature header, or a nil signature if the commit is not signed.
+func splitSignature(raw []byte) ([]byte, []byte) {
+	var sig []byte
+	signed := make([]byte, 0, len(raw))
+
+	var inSig bool
+	rest := raw
+	for len(rest) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line, rest = rest[:i+1], rest[i+1:]
+		} else {
+			line, rest = rest, nil
+		}
+
+		// a blank line ends the headers
+		if line[0] == '\n' {
+			signed = append(signed, line...)
+			signed = append(signed, rest...)
+			break
+		}
+
+		// continuation line of the signature
+		if inSig && line[0] == ' ' {
+			sig = append(sig, line[1:]...)
+			continue
+		}
+		inSig = false
+
+		if sig == nil {
+			for _, h := range signatureHeaders {
+				if bytes.HasPrefix(line, []byte(h+" ")) {
+					inSig = true
+					sig = append([]byte{}, line[len(h)+1:]...)
+					break
+				}
+			}
+			if inSig {
+				continue
+			}
+		}
+
+		signed = append(signed, line...)
+	}
+
+	return sig, signed
+}
+
+// signatureType returns the type of an armored signature.
+func signatureType(sig []byte) string {
+	firstLine := sig
+	if i := bytes.IndexByte(sig, '\n'); i >= 0 {
+		firstLine = sig[:i]
+	}
+	return signatureArmors[strings.TrimSpace(string(firstLine))]
+}
+
+// gpgKeyID returns the ID of the key used to make an armored OpenPGP
+// signature, or an empty string if it cannot be found.
+func gpgKeyID(sig []byte) string {
+	block, err := armor.Decode(bytes.NewReader(sig))
+	if err != nil {
+		return ""
+	}
+
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return ""
+	}
+
+	switch s := p.(type) {
+	case *packet.Signature:
+		if s.IssuerKeyId != nil {
+			return fmt.Sprintf("%016X", *s.IssuerKeyId)
+		}
+	case *packet.SignatureV3:
+		return fmt.Sprintf("%016X", s.IssuerKeyId)
+	}
+	return ""
+}
+
+// verifyGPG verifies an armored OpenPGP signature of signed against keyring
+// and returns the verification status. Keys using algorithms the openpgp
+// package does not support (ed25519, ...) are not part of keyring, and
+// signatures made with them cannot be parsed: they are reported as such
+// rather than as bad signatures.
+func verifyGPG(keyring openpgp.KeyRing, sig, signed []byte) string {
+	_, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(signed), bytes.NewReader(sig))
+	if err == nil {
+		return model.SignatureGood
+	}
+	if err == pgperrors.ErrUnknownIssuer {
+		return model.SignatureUnknownKey
+	}
+	if _, ok := err.(pgperrors.UnsupportedError); ok {
+		return model.SignatureUnsupported
+	}
+	return model.SignatureBad
+}
+
+// parseSSHSignature parses an armored SSH signature.
+func parseSSHSignature(sig []byte) (*sshSignature, error) {
+	lines := strings.Split(strings.TrimSpace(string(sig)), "\n")
+	if len(lines) < 3 {
+		return nil, errors.New("truncated SSH signature")
+	}
+
+	var b64 string
+	for _, line := range lines[1 : len(lines)-1] {
+		b64 += strings.TrimSpace(line)
+	}
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(sshSigMagic)) {
+		return nil, errors.New("invalid SSH signature preamble")
+	}
+
+	s := new(sshSignature)
+	if err := ssh.Unmarshal(data[len(sshSigMagic):], s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// verifySSH verifies an SSH signature of signed against a list of allowed
+// signers and returns the verification status. As for git, the key must be
+// allowed to sign for email, the email of the committer.
+func verifySSH(allowedSigners []allowedSigner, email string, s *sshSignature, signed []byte) string {
+	pub, err := ssh.ParsePublicKey(s.PublicKey)
+	if err != nil {
+		// key types unknown to the ssh package
+		return model.SignatureUnsupported
+	}
+
+	var allowed bool
+	for _, as := range allowedSigners {
+		if bytes.Equal(as.key.Marshal(), pub.Marshal()) && matchPrincipals(as.principals, email) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return model.SignatureUnknownKey
+	}
+
+	if s.Namespace != sshSigNamespace {
+		return model.SignatureBad
+	}
+
+	var h hash.Hash
+	switch s.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return model.SignatureUnsupported
+	}
+	h.Write(signed)
+
+	msg := []byte(sshSigMagic)
+	msg = append(msg, ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          string
+	}{s.Namespace, s.Reserved, s.HashAlgorithm, string(h.Sum(nil))})...)
+
+	sshSig := new(ssh.Signature)
+	if err := ssh.Unmarshal(s.Signature, sshSig); err != nil {
+		return model.SignatureBad
+	}
+
+	if err := pub.Verify(msg, sshSig); err != nil {
+		return model.SignatureBad
+	}
+	return model.SignatureGood
+}
+
+// readKeyring reads an OpenPGP keyring, armored or not.
+func readKeyring(path string) (openpgp.EntityList, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(bs), []byte("-----BEGIN")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(bs))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(bs))
+}
+
+// readAllowedSigners reads an SSH allowed signers file. Each line of the
+// file consists of principals, options and a public key, as in
+// authorized_keys files. Options are ignored.
+func readAllowedSigners(path string) ([]allowedSigner, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var signers []allowedSigner
+	for n, line := range strings.Split(string(bs), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		// principals may be quoted
+		var principals string
+		var end int
+		if line[0] == '"' {
+			end = strings.Index(line[1:], "\"") + 2
+			if end > 1 {
+				principals = line[1 : end-1]
+			}
+		} else {
+			end = strings.IndexAny(line, " \t")
+			if end > 0 {
+				principals = line[:end]
+			}
+		}
+		if end <= 1 || end >= len(line) {
+			return nil, fmt.Errorf("%s:%d: invalid allowed signer", path, n+1)
+		}
+
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line[end:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n+1, err)
+		}
+		signers = append(signers, allowedSigner{principals: principals, key: pub})
+	}
+
+	return signers, nil
+}
+
+// matchPrincipals tells whether email matches a comma separated list of
+// principals, as found in allowed signers files. As with OpenSSH, principals
+// are patterns where '*' matches any sequence of characters and '?' any
+// character, and patterns prefixed with '!' exclude what they match.
+// Emails being case insensitive, so is matching.
+func matchPrincipals(principals, email string) bool {
+	email = strings.ToLower(email)
+
+	var matched bool
+	for _, pattern := range strings.Split(strings.ToLower(principals), ",") {
+		negated := strings.HasPrefix(pattern, "!")
+		if !matchPattern(strings.TrimPrefix(pattern, "!"), email) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// matchPattern tells whether s matches pattern, where '*' matches any
+// sequence of characters and '?' any character.
+func matchPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// try every possible length for the sequence
+			for i := len(s); i >= 0; i-- {
+				if matchPattern(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
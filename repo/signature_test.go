@@ -0,0 +1,123 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"testing"
+
+	"github.com/DevMine/repotool/model"
+)
+
+func TestSplitSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		sig    string
+		signed string
+	}{
+		{
+			name:   "unsigned",
+			raw:    "tree 1234\nauthor Jane Doe <jane@example.org> 0 +0000\n\nFix it\n",
+			signed: "tree 1234\nauthor Jane Doe <jane@example.org> 0 +0000\n\nFix it\n",
+		},
+		{
+			name: "signed",
+			raw: "tree 1234\ngpgsig -----BEGIN PGP SIGNATURE-----\n \n abcd\n -----END PGP SIGNATURE-----\n" +
+				"committer Jane Doe <jane@example.org> 0 +0000\n\nFix it\n",
+			sig:    "-----BEGIN PGP SIGNATURE-----\n\nabcd\n-----END PGP SIGNATURE-----\n",
+			signed: "tree 1234\ncommitter Jane Doe <jane@example.org> 0 +0000\n\nFix it\n",
+		},
+		{
+			name:   "sha256 signature",
+			raw:    "tree 1234\ngpgsig-sha256 -----BEGIN SSH SIGNATURE-----\n abcd\n\nFix it\n",
+			sig:    "-----BEGIN SSH SIGNATURE-----\nabcd\n",
+			signed: "tree 1234\n\nFix it\n",
+		},
+		{
+			name:   "header in the message",
+			raw:    "tree 1234\n\ngpgsig -----BEGIN PGP SIGNATURE-----\n abcd\n",
+			signed: "tree 1234\n\ngpgsig -----BEGIN PGP SIGNATURE-----\n abcd\n",
+		},
+	}
+
+	for _, tt := range tests {
+		sig, signed := splitSignature([]byte(tt.raw))
+		if string(sig) != tt.sig || string(signed) != tt.signed {
+			t.Errorf("%s: got %q, %q, want %q, %q", tt.name, sig, signed, tt.sig, tt.signed)
+		}
+	}
+}
+
+func TestSignatureType(t *testing.T) {
+	tests := []struct {
+		sig  string
+		want string
+	}{
+		{"", ""},
+		{"-----BEGIN PGP SIGNATURE-----\n\nabcd\n", model.SignatureGPG},
+		{"-----BEGIN SSH SIGNATURE-----\nabcd\n", model.SignatureSSH},
+		{"-----BEGIN SIGNED MESSAGE-----\r\nabcd\n", model.SignatureX509},
+		{"-----BEGIN PGP MESSAGE-----\nabcd\n", ""},
+	}
+
+	for _, tt := range tests {
+		if got := signatureType([]byte(tt.sig)); got != tt.want {
+			t.Errorf("signatureType(%q) = %q, want %q", tt.sig, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"jane@example.org", "jane@example.org", true},
+		{"jane@example.org", "jane@example.com", false},
+		{"*", "", true},
+		{"*", "jane@example.org", true},
+		{"*@example.org", "jane@example.org", true},
+		{"*@example.org", "jane@example.org.evil", false},
+		{"j*e@*.org", "jane@example.org", true},
+		{"?ane@example.org", "jane@example.org", true},
+		{"?ane@example.org", "ane@example.org", false},
+		{"jane@example.org?", "jane@example.org", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchPattern(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPrincipals(t *testing.T) {
+	tests := []struct {
+		principals string
+		email      string
+		want       bool
+	}{
+		{"jane@example.org", "jane@example.org", true},
+		{"jane@example.org", "Jane@Example.ORG", true},
+		{"JANE@example.org", "jane@example.org", true},
+		{"jane@example.org", "john@example.org", false},
+		{"jane@example.org", "", false},
+		{"john@example.org,jane@example.org", "jane@example.org", true},
+		{"*@example.org", "jane@example.org", true},
+		{"*@example.org,!john@example.org", "john@example.org", false},
+		{"!john@example.org,*@example.org", "john@example.org", false},
+		{"!john@example.org,*@example.org", "jane@example.org", true},
+		{"!john@example.org", "jane@example.org", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchPrincipals(tt.principals, tt.email); got != tt.want {
+			t.Errorf("matchPrincipals(%q, %q) = %v, want %v", tt.principals, tt.email, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Errors that may be wrapped into a TarEntryError.
+var (
+	ErrAbsolutePath     = errors.New("absolute path")
+	ErrPathTraversal    = errors.New("path contains a '..' component")
+	ErrSymlinkEscape    = errors.New("link points outside of the destination")
+	ErrThroughSymlink   = errors.New("path goes through a symbolic link")
+	ErrFileTooLarge     = errors.New("file exceeds the size limit")
+	ErrArchiveTooLarge  = errors.New("archive content exceeds the size limit")
+	ErrUnsupportedEntry = errors.New("unsupported entry type")
+)
+
+// TarEntryError is returned when a tar archive contains an entry that cannot
+// be safely extracted.
+type TarEntryError struct {
+	// Archive is the path to the tar archive.
+	Archive string
+
+	// Entry is the name of the offending entry, as stored in the archive.
+	Entry string
+
+	// Err is the reason why the entry was rejected.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *TarEntryError) Error() string {
+	return fmt.Sprintf("%s: entry %q rejected: %v", e.Archive, e.Entry, e.Err)
+}
+
+// checkTarEntryName verifies that a tar entry name is relative and does not
+// contain any '..' component. Tar entry names always use forward slashes.
+func checkTarEntryName(name string) error {
+	if path.IsAbs(name) || filepath.IsAbs(name) || strings.HasPrefix(name, `\`) {
+		return ErrAbsolutePath
+	}
+
+	for _, c := range strings.FieldsFunc(name, isPathSeparator) {
+		if c == ".." {
+			return ErrPathTraversal
+		}
+	}
+
+	return nil
+}
+
+// checkSymlink verifies that a symbolic link created at linkPath and pointing
+// at target does not resolve to a location outside of destPath. Targets must
+// be relative and free of '..' components: checking where a target resolves
+// to is not enough, as it depends on the links created before and after it
+// (a link through which another one is resolved, for instance).
+func checkSymlink(destPath, linkPath, target string) error {
+	if path.IsAbs(target) || filepath.IsAbs(target) || strings.HasPrefix(target, `\`) {
+		return ErrSymlinkEscape
+	}
+
+	for _, c := range strings.FieldsFunc(target, isPathSeparator) {
+		if c == ".." {
+			return ErrSymlinkEscape
+		}
+	}
+
+	resolved := filepath.Join(filepath.Dir(linkPath), filepath.FromSlash(target))
+	if !isWithin(destPath, resolved) {
+		return ErrSymlinkEscape
+	}
+
+	return nil
+}
+
+// checkNoSymlink verifies that neither p nor any of its parent directories
+// below destPath is a symbolic link, so that nothing is written through a
+// link. Components that do not exist yet are fine.
+func checkNoSymlink(destPath, p string) error {
+	rel, err := filepath.Rel(filepath.Clean(destPath), filepath.Clean(p))
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+
+	cur := filepath.Clean(destPath)
+	for _, c := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, c)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return ErrThroughSymlink
+		}
+	}
+
+	return nil
+}
+
+// isWithin returns true if p is root or a path below root.
+func isWithin(root, p string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(p))
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isPathSeparator(r rune) bool {
+	return r == '/' || r == '\\'
+}
+
+// findArchiveGitDir looks for a git directory inside a tar archive and returns
+// its location relative to the archive root, with a trailing slash. The empty
+// string designates the archive root itself, which is where bare repositories
+// archived on their own are found. The boolean is false when no git directory
+// was found.
+//
+// A git directory is either a directory named .git or a directory containing
+// a HEAD file along with objects and refs directories (ie a bare repository).
+// The archive name does not matter, which allows an archive named
+// foo-2015-01-01.tar to contain foo/.git for instance. When several git
+// directories are found (vendored repositories, ...), the one closest to the
+// archive root wins, ties being broken in favor of the one whose parent
+// directory is named after the archive.
+func findArchiveGitDir(archivePath string) (string, bool, error) {
+	archiveFile, err := os.Open(archivePath)
+	if err != nil {
+		return "", false, err
+	}
+	defer archiveFile.Close()
+
+	// prefixes, with a trailing slash, that look like a git directory
+	dotGitDirs := map[string]bool{}
+	heads := map[string]bool{}
+	objects := map[string]bool{}
+	refs := map[string]bool{}
+
+	tr := tar.NewReader(archiveFile)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", false, err
+		}
+
+		name := normalizeTarEntryName(hdr.Name)
+		isDir := hdr.FileInfo().Mode()&os.ModeDir != 0
+		comps := strings.Split(strings.TrimSuffix(name, "/"), "/")
+		for i, c := range comps {
+			prefix := strings.Join(comps[:i], "/")
+			if i > 0 {
+				prefix += "/"
+			}
+			last := i == len(comps)-1
+
+			switch c {
+			case ".git":
+				// a .git file is a gitlink (submodule, worktree), not a git
+				// directory
+				if !last || isDir {
+					dotGitDirs[prefix+".git/"] = true
+				}
+			case "HEAD":
+				if last && !isDir {
+					heads[prefix] = true
+				}
+			case "objects":
+				objects[prefix] = true
+			case "refs":
+				refs[prefix] = true
+			}
+		}
+	}
+
+	candidates := make([]string, 0, len(dotGitDirs))
+	for dir := range dotGitDirs {
+		candidates = append(candidates, dir)
+	}
+	for dir := range heads {
+		if objects[dir] && refs[dir] && !dotGitDirs[dir] {
+			candidates = append(candidates, dir)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false, nil
+	}
+
+	archiveName := filepath.Base(strings.TrimSuffix(archivePath, ".tar"))
+	best := candidates[0]
+	for _, dir := range candidates[1:] {
+		if betterArchiveGitDir(dir, best, archiveName) {
+			best = dir
+		}
+	}
+
+	return best, true, nil
+}
+
+// betterArchiveGitDir returns true if the git directory a shall be preferred
+// over b for an archive named archiveName.
+func betterArchiveGitDir(a, b, archiveName string) bool {
+	da, db := strings.Count(a, "/"), strings.Count(b, "/")
+	if da != db {
+		return da < db
+	}
+
+	ma, mb := archiveGitDirName(a) == archiveName, archiveGitDirName(b) == archiveName
+	if ma != mb {
+		return ma
+	}
+
+	return a < b
+}
+
+// archiveGitDirName returns the name of the repository whose git directory is
+// dir: the name of the parent directory of a .git directory or the name of a
+// bare repository directory, without its .git extension.
+func archiveGitDirName(dir string) string {
+	dir = strings.TrimSuffix(dir, "/")
+	if path.Base(dir) == ".git" {
+		dir = path.Dir(dir)
+	}
+	return strings.TrimSuffix(path.Base(dir), ".git")
+}
+
+// normalizeTarEntryName removes the leading "./" some tools put in front of
+// tar entry names.
+func normalizeTarEntryName(name string) string {
+	for strings.HasPrefix(name, "./") {
+		name = strings.TrimPrefix(name, "./")
+	}
+	return name
+}
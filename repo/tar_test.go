@@ -0,0 +1,439 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DevMine/repotool/config"
+)
+
+// tarEntry describes an entry of a test archive.
+type tarEntry struct {
+	name     string
+	typ      byte
+	linkname string
+	content  string
+}
+
+// writeTarEntries writes a tar archive made of entries at archivePath.
+func writeTarEntries(t *testing.T, archivePath string, entries []tarEntry) {
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typ,
+			Linkname: e.linkname,
+			Mode:     0644,
+			Size:     int64(len(e.content)),
+		}
+		if e.typ == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if e.typ != tar.TypeReg {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckTarEntryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want error
+	}{
+		{"foo/.git/HEAD", nil},
+		{"./foo/.git/HEAD", nil},
+		{"foo/.git/objects/", nil},
+		{"foo..bar/.git/HEAD", nil},
+		{"/etc/passwd", ErrAbsolutePath},
+		{`\windows\system32`, ErrAbsolutePath},
+		{"..", ErrPathTraversal},
+		{"../foo/.git/HEAD", ErrPathTraversal},
+		{"foo/../../etc/passwd", ErrPathTraversal},
+		{`foo\..\..\etc\passwd`, ErrPathTraversal},
+		{"foo/.git/..", ErrPathTraversal},
+	}
+
+	for _, tt := range tests {
+		if got := checkTarEntryName(tt.name); got != tt.want {
+			t.Errorf("checkTarEntryName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSymlink(t *testing.T) {
+	dest := filepath.FromSlash("/tmp/dest/.git")
+
+	tests := []struct {
+		link   string
+		target string
+		want   error
+	}{
+		{"HEAD.link", "HEAD", nil},
+		{"objects/link", "pack/pack-1.pack", nil},
+		{"link", "objects/pack", nil},
+		{"link", "/etc/passwd", ErrSymlinkEscape},
+		{"link", `\etc\passwd`, ErrSymlinkEscape},
+		{"link", "..", ErrSymlinkEscape},
+		{"link", "../HEAD", ErrSymlinkEscape},
+		// resolves within the destination, yet may be combined with other
+		// links to escape from it
+		{"objects/up", "..", ErrSymlinkEscape},
+		{"t", "objects/up/../..", ErrSymlinkEscape},
+		{"objects/link", "pack/../../HEAD", ErrSymlinkEscape},
+		{"link", `objects\..\..`, ErrSymlinkEscape},
+	}
+
+	for _, tt := range tests {
+		linkPath := filepath.Join(dest, filepath.FromSlash(tt.link))
+		if got := checkSymlink(dest, linkPath, tt.target); got != tt.want {
+			t.Errorf("checkSymlink(%q -> %q) = %v, want %v", tt.link, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCheckNoSymlink(t *testing.T) {
+	dest, err := ioutil.TempDir("", "repotool-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+
+	if err := os.MkdirAll(filepath.Join(dest, "objects", "pack"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("objects", filepath.Join(dest, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"", nil},
+		{"HEAD", nil},
+		{"objects/pack/pack-1.pack", nil},
+		{"missing/dir/file", nil},
+		{"link", ErrThroughSymlink},
+		{"link/pack", ErrThroughSymlink},
+		{"link/pack/pack-1.pack", ErrThroughSymlink},
+	}
+
+	for _, tt := range tests {
+		p := filepath.Join(dest, filepath.FromSlash(tt.path))
+		if got := checkNoSymlink(dest, p); got != tt.want {
+			t.Errorf("checkNoSymlink(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestUntarGitFolder(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		want    error
+		// file expected in the extracted git directory, when no error is
+		// expected
+		file string
+	}{
+		{
+			name: "regular",
+			entries: []tarEntry{
+				{name: "foo/.git/", typ: tar.TypeDir},
+				{name: "foo/.git/HEAD", typ: tar.TypeReg, content: "ref: refs/heads/master\n"},
+				{name: "foo/.git/HEAD.link", typ: tar.TypeSymlink, linkname: "HEAD"},
+				{name: "foo/.git/HEAD.hard", typ: tar.TypeLink, linkname: "foo/.git/HEAD"},
+				{name: "foo/README", typ: tar.TypeReg, content: "not extracted"},
+			},
+			file: "HEAD.hard",
+		},
+		{
+			name: "path traversal",
+			entries: []tarEntry{
+				{name: "foo/.git/../../evil", typ: tar.TypeReg, content: "evil"},
+			},
+			want: ErrPathTraversal,
+		},
+		{
+			name: "absolute link",
+			entries: []tarEntry{
+				{name: "foo/.git/evil", typ: tar.TypeSymlink, linkname: "/etc"},
+			},
+			want: ErrSymlinkEscape,
+		},
+		{
+			name: "link out of the git directory",
+			entries: []tarEntry{
+				{name: "foo/.git/evil", typ: tar.TypeSymlink, linkname: "../README"},
+			},
+			want: ErrSymlinkEscape,
+		},
+		{
+			name: "chained links",
+			entries: []tarEntry{
+				{name: "foo/.git/objects/up", typ: tar.TypeSymlink, linkname: ".."},
+				{name: "foo/.git/t", typ: tar.TypeSymlink, linkname: "objects/up/../.."},
+				{name: "foo/.git/t/evil", typ: tar.TypeReg, content: "evil"},
+			},
+			want: ErrSymlinkEscape,
+		},
+		{
+			name: "file written through a link",
+			entries: []tarEntry{
+				{name: "foo/.git/objects/", typ: tar.TypeDir},
+				{name: "foo/.git/link", typ: tar.TypeSymlink, linkname: "objects"},
+				{name: "foo/.git/link/evil", typ: tar.TypeReg, content: "evil"},
+			},
+			want: ErrThroughSymlink,
+		},
+		{
+			name: "nested links",
+			entries: []tarEntry{
+				{name: "foo/.git/a/b/", typ: tar.TypeDir},
+				{name: "foo/.git/a/b/c", typ: tar.TypeSymlink, linkname: "d"},
+				{name: "foo/.git/a/b/c/e/f", typ: tar.TypeReg, content: "evil"},
+			},
+			want: ErrThroughSymlink,
+		},
+		{
+			name: "link overwritten by a file",
+			entries: []tarEntry{
+				{name: "foo/.git/link", typ: tar.TypeSymlink, linkname: "HEAD"},
+				{name: "foo/.git/link", typ: tar.TypeReg, content: "evil"},
+			},
+			want: ErrThroughSymlink,
+		},
+		{
+			name: "hard link through a link",
+			entries: []tarEntry{
+				{name: "foo/.git/objects/HEAD", typ: tar.TypeReg, content: "ref: refs/heads/master\n"},
+				{name: "foo/.git/link", typ: tar.TypeSymlink, linkname: "objects"},
+				{name: "foo/.git/HEAD", typ: tar.TypeLink, linkname: "foo/.git/link/HEAD"},
+			},
+			want: ErrThroughSymlink,
+		},
+		{
+			name: "hard link out of the git directory",
+			entries: []tarEntry{
+				{name: "foo/README", typ: tar.TypeReg, content: "readme"},
+				{name: "foo/.git/HEAD", typ: tar.TypeLink, linkname: "foo/README"},
+			},
+			want: ErrSymlinkEscape,
+		},
+		{
+			name: "device",
+			entries: []tarEntry{
+				{name: "foo/.git/dev", typ: tar.TypeChar},
+			},
+			want: ErrUnsupportedEntry,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "repotool-test-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			archivePath := filepath.Join(tmp, "foo.tar")
+			writeTarEntries(t, archivePath, tt.entries)
+
+			dest := filepath.Join(tmp, "dest")
+			err = untarGitFolder(config.DataConfig{}, dest, archivePath, "foo/.git/", nil)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := os.Lstat(filepath.Join(dest, ".git", tt.file)); err != nil {
+					t.Error(err)
+				}
+				if _, err := os.Lstat(filepath.Join(dest, "README")); !os.IsNotExist(err) {
+					t.Error("file outside of the git directory extracted")
+				}
+				return
+			}
+
+			tarErr, ok := err.(*TarEntryError)
+			if !ok || tarErr.Err != tt.want {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+
+			// nothing may have been written outside of the git directory
+			if _, err := os.Lstat(filepath.Join(tmp, "evil")); !os.IsNotExist(err) {
+				t.Error("file written outside of the destination")
+			}
+		})
+	}
+}
+
+func TestUntarGitFolderSizeLimits(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "repotool-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	content := make([]byte, 1024)
+	archivePath := filepath.Join(tmp, "foo.tar")
+	writeTarEntries(t, archivePath, []tarEntry{
+		{name: "foo/.git/a", typ: tar.TypeReg, content: string(content)},
+		{name: "foo/.git/b", typ: tar.TypeReg, content: string(content)},
+	})
+
+	tests := []struct {
+		name string
+		cfg  config.DataConfig
+		want error
+	}{
+		{"no limit", config.DataConfig{}, nil},
+		{"file too large", config.DataConfig{TarFileSizeLimit: bytesToGigaBytes(1000)}, ErrFileTooLarge},
+		{"archive too large", config.DataConfig{TarSizeLimit: bytesToGigaBytes(2000)}, ErrArchiveTooLarge},
+	}
+
+	for i, tt := range tests {
+		dest := filepath.Join(tmp, "dest", string('a'+rune(i)))
+		err := untarGitFolder(tt.cfg, dest, archivePath, "foo/.git/", nil)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if tarErr, ok := err.(*TarEntryError); !ok || tarErr.Err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestFindArchiveGitDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		archive string
+		entries []string
+		want    string
+		found   bool
+	}{
+		{
+			name:    "named after the archive",
+			archive: "foo.tar",
+			entries: []string{"foo/", "foo/.git/", "foo/.git/HEAD", "foo/README"},
+			want:    "foo/.git/",
+			found:   true,
+		},
+		{
+			name:    "not named after the archive",
+			archive: "foo-2015-01-01.tar",
+			entries: []string{"foo/.git/HEAD", "foo/.git/objects/"},
+			want:    "foo/.git/",
+			found:   true,
+		},
+		{
+			name:    "leading ./",
+			archive: "foo.tar",
+			entries: []string{"./foo/.git/HEAD"},
+			want:    "foo/.git/",
+			found:   true,
+		},
+		{
+			name:    "bare repository at the root",
+			archive: "foo.tar",
+			entries: []string{"HEAD", "objects/", "refs/heads/master"},
+			want:    "",
+			found:   true,
+		},
+		{
+			name:    "bare repository directory",
+			archive: "foo.tar",
+			entries: []string{"foo.git/HEAD", "foo.git/objects/pack/", "foo.git/refs/"},
+			want:    "foo.git/",
+			found:   true,
+		},
+		{
+			name:    "closest to the root",
+			archive: "foo.tar",
+			entries: []string{"foo/vendor/bar/.git/HEAD", "foo/.git/HEAD"},
+			want:    "foo/.git/",
+			found:   true,
+		},
+		{
+			name:    "tie broken by the archive name",
+			archive: "foo.tar",
+			entries: []string{"bar/.git/HEAD", "foo/.git/HEAD"},
+			want:    "foo/.git/",
+			found:   true,
+		},
+		{
+			name:    "tie broken by name order",
+			archive: "baz.tar",
+			entries: []string{"foo/.git/HEAD", "bar/.git/HEAD"},
+			want:    "bar/.git/",
+			found:   true,
+		},
+		{
+			name:    "gitlink file",
+			archive: "foo.tar",
+			entries: []string{"foo/.git", "foo/README"},
+			found:   false,
+		},
+		{
+			name:    "HEAD without objects nor refs",
+			archive: "foo.tar",
+			entries: []string{"foo/HEAD", "foo/refs/"},
+			found:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "repotool-test-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			entries := make([]tarEntry, 0, len(tt.entries))
+			for _, name := range tt.entries {
+				typ := byte(tar.TypeReg)
+				if name[len(name)-1] == '/' {
+					typ = tar.TypeDir
+				}
+				entries = append(entries, tarEntry{name: name, typ: typ})
+			}
+			archivePath := filepath.Join(tmp, tt.archive)
+			writeTarEntries(t, archivePath, entries)
+
+			got, found, err := findArchiveGitDir(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.found || got != tt.want {
+				t.Errorf("got %q, %v, want %q, %v", got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
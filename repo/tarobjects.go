@@ -0,0 +1,602 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// objectType is the type of a git object, numbered as in packfiles and
+// libgit2.
+type objectType int
+
+// Types of git objects.
+const (
+	objectCommit   objectType = 1
+	objectTree     objectType = 2
+	objectBlob     objectType = 3
+	objectTag      objectType = 4
+	objectOfsDelta objectType = 6
+	objectRefDelta objectType = 7
+)
+
+// objectTypes maps the names of object types, as found in the headers of
+// loose objects, to object types.
+var objectTypes = map[string]objectType{
+	"commit": objectCommit,
+	"tree":   objectTree,
+	"blob":   objectBlob,
+	"tag":    objectTag,
+}
+
+const (
+	// maxDeltaDepth is the maximum length of a chain of deltas. It protects
+	// against corrupt packfiles whose deltas form a cycle.
+	maxDeltaDepth = 10000
+
+	// maxCachedBases is the maximum size, in bytes, of the delta bases kept
+	// in memory.
+	maxCachedBases = 64 * 1024 * 1024
+)
+
+// errObjectNotFound is returned when an object is not found in the archive.
+var errObjectNotFound = errors.New("object not found")
+
+// tarSection locates the content of a tar entry in the archive.
+type tarSection struct {
+	offset int64
+	size   int64
+}
+
+// tarPack is a packfile stored in a tar archive, along with its index.
+type tarPack struct {
+	data *io.SectionReader
+
+	// IDs of the objects of the pack, sorted, 20 bytes each, and their
+	// offsets in the pack
+	ids     []byte
+	offsets []int64
+}
+
+// find returns the offset of an object in the pack.
+func (p *tarPack) find(id [20]byte) (int64, bool) {
+	n := len(p.offsets)
+	i := sort.Search(n, func(i int) bool {
+		return bytes.Compare(p.ids[i*20:i*20+20], id[:]) >= 0
+	})
+	if i < n && bytes.Equal(p.ids[i*20:i*20+20], id[:]) {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// baseKey identifies a delta base in the cache.
+type baseKey struct {
+	pack   *tarPack
+	offset int64
+}
+
+// cachedObject is an object kept in memory.
+type cachedObject struct {
+	typ  objectType
+	data []byte
+}
+
+// tarObjects serves the objects of a git directory stored in a tar archive,
+// be they loose or packed, straight from the archive. The archive is scanned
+// once, when extracting the other files of the git directory, the location
+// of object files being recorded.
+type tarObjects struct {
+	archivePath string
+	f           *os.File
+
+	// maxObjectSize is the maximum size of an object, in bytes, or 0 for no
+	// limit
+	maxObjectSize int64
+
+	loose map[[20]byte]tarSection
+	packs []*tarPack
+
+	// packs and indexes being indexed, by path without extension
+	packFiles map[string]tarSection
+	idxFiles  map[string]tarSection
+
+	mu        sync.Mutex
+	bases     map[baseKey]cachedObject
+	basesSize int
+}
+
+// openTarObjects opens the tar archive found at archivePath for objects to be
+// read from it. Objects larger than maxObjectSize bytes are rejected, unless
+// maxObjectSize is 0.
+func openTarObjects(archivePath string, maxObjectSize int64) (*tarObjects, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tarObjects{
+		archivePath:   archivePath,
+		f:             f,
+		maxObjectSize: maxObjectSize,
+		loose:         make(map[[20]byte]tarSection),
+		packFiles:     make(map[string]tarSection),
+		idxFiles:      make(map[string]tarSection),
+		bases:         make(map[baseKey]cachedObject),
+	}, nil
+}
+
+// Close closes the archive.
+func (to *tarObjects) Close() error {
+	return to.f.Close()
+}
+
+// add records the location of the file whose path, relative to the git
+// directory, is name, if it is a loose object, a packfile or a pack index.
+// It returns false if the file is none of those.
+func (to *tarObjects) add(name string, s tarSection) bool {
+	if !strings.HasPrefix(name, "objects/") {
+		return false
+	}
+	rel := strings.TrimPrefix(name, "objects/")
+
+	if strings.HasPrefix(rel, "pack/pack-") {
+		switch {
+		case strings.HasSuffix(rel, ".pack"):
+			to.packFiles[strings.TrimSuffix(rel, ".pack")] = s
+			return true
+		case strings.HasSuffix(rel, ".idx"):
+			to.idxFiles[strings.TrimSuffix(rel, ".idx")] = s
+			return true
+		}
+		return false
+	}
+
+	// loose objects are found at objects/xx/yyyy..., xx being the first byte
+	// of their ID
+	if len(rel) != 41 || rel[2] != '/' {
+		return false
+	}
+	b, err := hex.DecodeString(rel[:2] + rel[3:])
+	if err != nil {
+		return false
+	}
+	var id [20]byte
+	copy(id[:], b)
+	to.loose[id] = s
+
+	return true
+}
+
+// section returns the location of a file previously added, whose path
+// relative to the git directory is name.
+func (to *tarObjects) section(name string) (tarSection, bool) {
+	rel := strings.TrimPrefix(name, "objects/")
+	if s, ok := to.packFiles[strings.TrimSuffix(rel, ".pack")]; ok && strings.HasSuffix(rel, ".pack") {
+		return s, true
+	}
+	if s, ok := to.idxFiles[strings.TrimSuffix(rel, ".idx")]; ok && strings.HasSuffix(rel, ".idx") {
+		return s, true
+	}
+	if len(rel) == 41 && rel[2] == '/' {
+		if b, err := hex.DecodeString(rel[:2] + rel[3:]); err == nil {
+			var id [20]byte
+			copy(id[:], b)
+			s, ok := to.loose[id]
+			return s, ok
+		}
+	}
+	return tarSection{}, false
+}
+
+// isSparseTarEntry returns true if hdr is a PAX sparse file entry, whose
+// content is not stored as is in the archive.
+func isSparseTarEntry(hdr *tar.Header) bool {
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// load reads the indexes of the packs once the archive has been scanned.
+// Packs without an index, and indexes without a pack, are ignored.
+func (to *tarObjects) load() error {
+	names := make([]string, 0, len(to.idxFiles))
+	for name := range to.idxFiles {
+		if _, ok := to.packFiles[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		idxSection := to.idxFiles[name]
+		idx, err := ioutil.ReadAll(io.NewSectionReader(to.f, idxSection.offset, idxSection.size))
+		if err != nil {
+			return err
+		}
+
+		ids, offsets, err := parsePackIndex(idx)
+		if err != nil {
+			return fmt.Errorf("%s: objects/%s.idx: %v", to.archivePath, name, err)
+		}
+
+		packSection := to.packFiles[name]
+		to.packs = append(to.packs, &tarPack{
+			data:    io.NewSectionReader(to.f, packSection.offset, packSection.size),
+			ids:     ids,
+			offsets: offsets,
+		})
+	}
+
+	to.packFiles, to.idxFiles = nil, nil
+	return nil
+}
+
+// exists tells whether the object whose ID is id is found in the archive.
+func (to *tarObjects) exists(id [20]byte) bool {
+	if _, ok := to.loose[id]; ok {
+		return true
+	}
+	for _, p := range to.packs {
+		if _, ok := p.find(id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// read returns the type and content of the object whose ID is id.
+// errObjectNotFound is returned if the archive does not contain it.
+func (to *tarObjects) read(id [20]byte) (objectType, []byte, error) {
+	return to.readDepth(id, 0)
+}
+
+func (to *tarObjects) readDepth(id [20]byte, depth int) (objectType, []byte, error) {
+	for _, p := range to.packs {
+		if offset, ok := p.find(id); ok {
+			return to.readPacked(p, offset, depth)
+		}
+	}
+
+	if s, ok := to.loose[id]; ok {
+		return to.readLoose(id, s)
+	}
+
+	return 0, nil, errObjectNotFound
+}
+
+// readLoose reads a loose object: a zlib compressed "<type> <size>\0"
+// header followed by the content of the object.
+func (to *tarObjects) readLoose(id [20]byte, s tarSection) (objectType, []byte, error) {
+	zr, err := zlib.NewReader(io.NewSectionReader(to.f, s.offset, s.size))
+	if err != nil {
+		return 0, nil, to.corrupt(id, err)
+	}
+	defer zr.Close()
+
+	br := bufio.NewReader(zr)
+	header, err := br.ReadString(0)
+	if err != nil {
+		return 0, nil, to.corrupt(id, err)
+	}
+
+	fields := strings.Fields(strings.TrimSuffix(header, "\x00"))
+	if len(fields) != 2 {
+		return 0, nil, to.corrupt(id, errors.New("invalid header"))
+	}
+	typ, ok := objectTypes[fields[0]]
+	if !ok {
+		return 0, nil, to.corrupt(id, errors.New("invalid type"))
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, nil, to.corrupt(id, errors.New("invalid size"))
+	}
+	if err := to.checkSize(size); err != nil {
+		return 0, nil, to.corrupt(id, err)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return 0, nil, to.corrupt(id, err)
+	}
+
+	return typ, data, nil
+}
+
+// readPacked reads the object found at offset in a pack, resolving deltas.
+func (to *tarObjects) readPacked(p *tarPack, offset int64, depth int) (objectType, []byte, error) {
+	if depth > maxDeltaDepth {
+		return 0, nil, fmt.Errorf("%s: delta chain too long", to.archivePath)
+	}
+
+	key := baseKey{pack: p, offset: offset}
+	to.mu.Lock()
+	cached, ok := to.bases[key]
+	to.mu.Unlock()
+	if ok {
+		return cached.typ, cached.data, nil
+	}
+
+	if offset < 0 || offset >= p.data.Size() {
+		return 0, nil, fmt.Errorf("%s: invalid pack offset %d", to.archivePath, offset)
+	}
+	br := bufio.NewReader(io.NewSectionReader(p.data, offset, p.data.Size()-offset))
+
+	// header: type and size, as a variable length integer
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	typ := objectType((c >> 4) & 7)
+	size := int64(c & 15)
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		if shift > 56 {
+			return 0, nil, fmt.Errorf("%s: invalid object size at pack offset %d", to.archivePath, offset)
+		}
+		if c, err = br.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+		size |= int64(c&0x7f) << shift
+	}
+	if err := to.checkSize(size); err != nil {
+		return 0, nil, err
+	}
+
+	var data []byte
+	switch typ {
+	case objectCommit, objectTree, objectBlob, objectTag:
+		if data, err = inflate(br, size); err != nil {
+			return 0, nil, err
+		}
+	case objectOfsDelta, objectRefDelta:
+		var baseType objectType
+		var base []byte
+		if typ == objectOfsDelta {
+			// offset of the base, relative to the object
+			c, err := br.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			rel := int64(c & 0x7f)
+			for c&0x80 != 0 {
+				if c, err = br.ReadByte(); err != nil {
+					return 0, nil, err
+				}
+				if rel > (1<<55)-1 {
+					return 0, nil, fmt.Errorf("%s: invalid delta base offset at pack offset %d", to.archivePath, offset)
+				}
+				rel = ((rel + 1) << 7) | int64(c&0x7f)
+			}
+			baseType, base, err = to.readPacked(p, offset-rel, depth+1)
+		} else {
+			var baseID [20]byte
+			if _, err := io.ReadFull(br, baseID[:]); err != nil {
+				return 0, nil, err
+			}
+			baseType, base, err = to.readDepth(baseID, depth+1)
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		delta, err := inflate(br, size)
+		if err != nil {
+			return 0, nil, err
+		}
+		if data, err = to.applyDelta(base, delta); err != nil {
+			return 0, nil, err
+		}
+		typ = baseType
+	default:
+		return 0, nil, fmt.Errorf("%s: invalid object type %d at pack offset %d", to.archivePath, typ, offset)
+	}
+
+	to.cacheBase(key, typ, data)
+	return typ, data, nil
+}
+
+// cacheBase keeps an object read from a pack in memory, as it may be the base
+// of other deltas. The cache is emptied once full.
+func (to *tarObjects) cacheBase(key baseKey, typ objectType, data []byte) {
+	if len(data) > maxCachedBases/16 {
+		return
+	}
+
+	to.mu.Lock()
+	defer to.mu.Unlock()
+
+	if to.basesSize+len(data) > maxCachedBases {
+		to.bases = make(map[baseKey]cachedObject)
+		to.basesSize = 0
+	}
+	to.bases[key] = cachedObject{typ: typ, data: data}
+	to.basesSize += len(data)
+}
+
+// applyDelta applies a delta to its base. A delta starts with the sizes of
+// the base and of the result, followed by instructions copying parts of the
+// base or inserting new data.
+func (to *tarObjects) applyDelta(base, delta []byte) ([]byte, error) {
+	errCorrupt := fmt.Errorf("%s: corrupt delta", to.archivePath)
+
+	baseSize, n := binary.Uvarint(delta)
+	if n <= 0 || baseSize != uint64(len(base)) {
+		return nil, errCorrupt
+	}
+	delta = delta[n:]
+
+	resultSize, n := binary.Uvarint(delta)
+	if n <= 0 || resultSize > 1<<62 {
+		return nil, errCorrupt
+	}
+	if err := to.checkSize(int64(resultSize)); err != nil {
+		return nil, err
+	}
+	delta = delta[n:]
+
+	result := make([]byte, 0, int(resultSize))
+	for len(delta) > 0 {
+		cmd := delta[0]
+		delta = delta[1:]
+
+		switch {
+		case cmd&0x80 != 0:
+			// copy from the base
+			var offset, size uint64
+			for i := uint(0); i < 4; i++ {
+				if cmd&(1<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errCorrupt
+					}
+					offset |= uint64(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if cmd&(0x10<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errCorrupt
+					}
+					size |= uint64(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, errCorrupt
+			}
+			result = append(result, base[offset:offset+size]...)
+		case cmd != 0:
+			// insert new data
+			if int(cmd) > len(delta) {
+				return nil, errCorrupt
+			}
+			result = append(result, delta[:cmd]...)
+			delta = delta[cmd:]
+		default:
+			return nil, errCorrupt
+		}
+
+		if uint64(len(result)) > resultSize {
+			return nil, errCorrupt
+		}
+	}
+
+	if uint64(len(result)) != resultSize {
+		return nil, errCorrupt
+	}
+	return result, nil
+}
+
+// checkSize verifies that an object of the given size may be read.
+func (to *tarObjects) checkSize(size int64) error {
+	if size < 0 || (to.maxObjectSize > 0 && size > to.maxObjectSize) {
+		return fmt.Errorf("%s: object exceeds the size limit", to.archivePath)
+	}
+	return nil
+}
+
+// corrupt returns an error telling the object whose ID is id is corrupt.
+func (to *tarObjects) corrupt(id [20]byte, err error) error {
+	return fmt.Errorf("%s: corrupt object %x: %v", to.archivePath, id[:], err)
+}
+
+// inflate reads size bytes of zlib compressed data from r.
+func inflate(r io.Reader, size int64) ([]byte, error) {
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parsePackIndex parses a pack index, in version 1 or 2, and returns the
+// sorted IDs of the objects of the pack, 20 bytes each, and their offsets in
+// the pack.
+func parsePackIndex(idx []byte) ([]byte, []int64, error) {
+	errCorrupt := errors.New("corrupt pack index")
+
+	if len(idx) >= 8 && bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) {
+		if binary.BigEndian.Uint32(idx[4:8]) != 2 {
+			return nil, nil, errors.New("unsupported pack index version")
+		}
+		if len(idx) < 8+1024 {
+			return nil, nil, errCorrupt
+		}
+
+		// fan-out table, then IDs, CRCs, offsets, large offsets and the
+		// checksums of the pack and of the index
+		n := int64(binary.BigEndian.Uint32(idx[8+1020 : 8+1024]))
+		pos := int64(8 + 1024)
+		if int64(len(idx)) < pos+n*28+40 {
+			return nil, nil, errCorrupt
+		}
+		ids := idx[pos : pos+n*20]
+		pos += n * 24
+		offs := idx[pos : pos+n*4]
+		pos += n * 4
+		large := idx[pos : int64(len(idx))-40]
+
+		offsets := make([]int64, n)
+		for i := range offsets {
+			o := binary.BigEndian.Uint32(offs[i*4:])
+			if o&0x80000000 == 0 {
+				offsets[i] = int64(o)
+				continue
+			}
+			j := int(o & 0x7fffffff)
+			if j*8+8 > len(large) {
+				return nil, nil, errCorrupt
+			}
+			offsets[i] = int64(binary.BigEndian.Uint64(large[j*8:]))
+		}
+
+		return ids, offsets, nil
+	}
+
+	// version 1: fan-out table, then offsets and IDs
+	if len(idx) < 1024 {
+		return nil, nil, errCorrupt
+	}
+	n := int64(binary.BigEndian.Uint32(idx[1020:1024]))
+	if int64(len(idx)) < 1024+n*24+40 {
+		return nil, nil, errCorrupt
+	}
+	ids := make([]byte, n*20)
+	offsets := make([]int64, n)
+	for i := int64(0); i < n; i++ {
+		entry := idx[1024+i*24:]
+		offsets[i] = int64(binary.BigEndian.Uint32(entry))
+		copy(ids[i*20:], entry[4:24])
+	}
+
+	return ids, offsets, nil
+}
@@ -0,0 +1,324 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DevMine/repotool/config"
+)
+
+// runGit runs git in dir and returns its output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=Jane Doe", "GIT_AUTHOR_EMAIL=jane@example.org",
+		"GIT_COMMITTER_NAME=Jane Doe", "GIT_COMMITTER_EMAIL=jane@example.org",
+		"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// writeTar archives the content of dir, under the name prefix, into a tar
+// archive written at archivePath.
+func writeTar(t *testing.T, archivePath, dir, prefix string) {
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	err = filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTarObjects(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	tests := []struct {
+		name string
+		// pack index version and whether deltas refer to their base by
+		// offset (OFS_DELTA) or by ID (REF_DELTA)
+		indexVersion     int
+		deltaBaseOffsets bool
+	}{
+		{name: "index v2, offset deltas", indexVersion: 2, deltaBaseOffsets: true},
+		{name: "index v1, ID deltas", indexVersion: 1, deltaBaseOffsets: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp, err := ioutil.TempDir("", "repotool-test-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tmp)
+
+			// a few versions of a large file, for deltas to be created, then
+			// packed objects and loose ones
+			work := filepath.Join(tmp, "work")
+			if err := os.Mkdir(work, 0755); err != nil {
+				t.Fatal(err)
+			}
+			runGit(t, work, "init", "-q")
+			var content bytes.Buffer
+			for i := 0; i < 5; i++ {
+				for j := 0; j < 200; j++ {
+					fmt.Fprintf(&content, "line %d of version %d\n", j, i%2)
+				}
+				if err := ioutil.WriteFile(filepath.Join(work, "file.txt"), content.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				runGit(t, work, "add", "file.txt")
+				runGit(t, work, "commit", "-q", "-m", fmt.Sprintf("version %d", i))
+			}
+			runGit(t, work,
+				"-c", fmt.Sprintf("pack.indexVersion=%d", tt.indexVersion),
+				"-c", fmt.Sprintf("repack.useDeltaBaseOffset=%t", tt.deltaBaseOffsets),
+				"repack", "-a", "-d", "-f", "-q")
+			if err := ioutil.WriteFile(filepath.Join(work, "loose.txt"), []byte("loose\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			runGit(t, work, "add", "loose.txt")
+			runGit(t, work, "commit", "-q", "-m", "loose")
+
+			archivePath := filepath.Join(tmp, "work.tar")
+			writeTar(t, archivePath, work, "work")
+
+			gitDir, ok, err := findArchiveGitDir(archivePath)
+			if err != nil || !ok {
+				t.Fatalf("findArchiveGitDir: %q, %v, %v", gitDir, ok, err)
+			}
+
+			objects, err := openTarObjects(archivePath, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer objects.Close()
+
+			dest := filepath.Join(tmp, "dest")
+			if err := untarGitFolder(config.DataConfig{}, dest, archivePath, gitDir, objects); err != nil {
+				t.Fatal(err)
+			}
+
+			// no object file shall have been extracted, unlike
+			// objects/info/packs and the like
+			err = filepath.Walk(filepath.Join(dest, ".git", "objects"), func(p string, fi os.FileInfo, err error) error {
+				if err == nil && fi.IsDir() && fi.Name() == "info" {
+					return filepath.SkipDir
+				}
+				if err == nil && !fi.IsDir() {
+					t.Errorf("%s extracted", p)
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(filepath.Join(dest, ".git", "HEAD")); err != nil {
+				t.Errorf("HEAD not extracted: %v", err)
+			}
+
+			list := runGit(t, work, "cat-file", "--batch-all-objects", "--batch-check=%(objectname) %(objecttype)")
+			for _, line := range strings.Split(strings.TrimSpace(list), "\n") {
+				fields := strings.Fields(line)
+				b, err := hex.DecodeString(fields[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				var id [20]byte
+				copy(id[:], b)
+
+				if !objects.exists(id) {
+					t.Errorf("%s: not found", fields[0])
+					continue
+				}
+				typ, data, err := objects.read(id)
+				if err != nil {
+					t.Errorf("%s: %v", fields[0], err)
+					continue
+				}
+				if typ != objectTypes[fields[1]] {
+					t.Errorf("%s: type %d, want %s", fields[0], typ, fields[1])
+				}
+				if want := runGit(t, work, "cat-file", fields[1], fields[0]); string(data) != want {
+					t.Errorf("%s: content differs", fields[0])
+				}
+			}
+
+			var missing [20]byte
+			if objects.exists(missing) {
+				t.Error("unexpected object found")
+			}
+			if _, _, err := objects.read(missing); err != errObjectNotFound {
+				t.Errorf("got %v, want errObjectNotFound", err)
+			}
+		})
+	}
+}
+
+func TestTarObjectsSizeLimit(t *testing.T) {
+	to := &tarObjects{maxObjectSize: 10}
+	if err := to.checkSize(10); err != nil {
+		t.Errorf("size 10: %v", err)
+	}
+	if err := to.checkSize(11); err == nil {
+		t.Error("size 11: no error")
+	}
+	if err := (&tarObjects{}).checkSize(1 << 40); err != nil {
+		t.Errorf("no limit: %v", err)
+	}
+}
+
+func TestTarObjectsAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"objects/ab/01234567890123456789012345678901234567", true},
+		{"objects/pack/pack-0123.pack", true},
+		{"objects/pack/pack-0123.idx", true},
+		{"objects/pack/pack-0123.keep", false},
+		{"objects/info/packs", false},
+		{"objects/zz/01234567890123456789012345678901234567", false},
+		{"objects/ab/0123", false},
+		{"refs/heads/master", false},
+		{"HEAD", false},
+	}
+
+	to, err := openTarObjects(os.DevNull, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+
+	for _, tt := range tests {
+		s := tarSection{offset: 512, size: 42}
+		if got := to.add(tt.name, s); got != tt.want {
+			t.Errorf("add(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+		got, ok := to.section(tt.name)
+		if ok != tt.want || (ok && got != s) {
+			t.Errorf("section(%q) = %v, %v", tt.name, got, ok)
+		}
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("hello, world\n")
+
+	tests := []struct {
+		name  string
+		delta []byte
+		want  string
+		err   bool
+	}{
+		{
+			name: "copy and insert",
+			// base size 13, result size 13: copy "hello" then insert
+			// ", there\n"
+			delta: []byte{13, 13, 0x90, 5, 8, ',', ' ', 't', 'h', 'e', 'r', 'e', '\n'},
+			want:  "hello, there\n",
+		},
+		{
+			name: "copy with offset",
+			// copy "world" from offset 7
+			delta: []byte{13, 5, 0x91, 7, 5},
+			want:  "world",
+		},
+		{name: "wrong base size", delta: []byte{12, 5, 0x91, 7, 5}, err: true},
+		{name: "wrong result size", delta: []byte{13, 6, 0x91, 7, 5}, err: true},
+		{name: "copy out of base", delta: []byte{13, 5, 0x91, 10, 5}, err: true},
+		{name: "truncated insert", delta: []byte{13, 5, 5, 'a'}, err: true},
+		{name: "truncated copy", delta: []byte{13, 5, 0x91, 7}, err: true},
+		{name: "reserved instruction", delta: []byte{13, 0, 0}, err: true},
+		{name: "empty", delta: nil, err: true},
+	}
+
+	to := &tarObjects{}
+	for _, tt := range tests {
+		got, err := to.applyDelta(base, tt.delta)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v", tt.name, err)
+			continue
+		}
+		if err == nil && string(got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParsePackIndexCorrupt(t *testing.T) {
+	v2 := append([]byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}, make([]byte, 1024)...)
+	v2[len(v2)-1] = 3 // 3 objects, but no room for them
+
+	tests := []struct {
+		name string
+		idx  []byte
+	}{
+		{"empty", nil},
+		{"short v1", make([]byte, 100)},
+		{"short v2", []byte{0xff, 't', 'O', 'c', 0, 0, 0, 2}},
+		{"unsupported version", []byte{0xff, 't', 'O', 'c', 0, 0, 0, 3}},
+		{"truncated v2", v2},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := parsePackIndex(tt.idx); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright 2014-2015 The DevMine authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ */
+
+#include <stdlib.h>
+
+#include "tarodb.h"
+#include "_cgo_export.h"
+
+/* tar_odb_backend is a backend along with the handle of its archive. */
+typedef struct {
+	git_odb_backend parent;
+	uintptr_t handle;
+} tar_odb_backend;
+
+static int tar_odb_read(void **data, size_t *len, git_otype *type, git_odb_backend *backend, const git_oid *oid)
+{
+	return tarOdbRead(data, len, type, backend, (git_oid *)oid);
+}
+
+static int tar_odb_read_header(size_t *len, git_otype *type, git_odb_backend *backend, const git_oid *oid)
+{
+	return tarOdbReadHeader(len, type, backend, (git_oid *)oid);
+}
+
+static int tar_odb_exists(git_odb_backend *backend, const git_oid *oid)
+{
+	return tarOdbExists(backend, (git_oid *)oid);
+}
+
+static void tar_odb_free(git_odb_backend *backend)
+{
+	tarOdbFree(backend);
+	free(backend);
+}
+
+git_odb_backend *tar_odb_new(uintptr_t handle)
+{
+	tar_odb_backend *b = calloc(1, sizeof(tar_odb_backend));
+	if (b == NULL)
+		return NULL;
+
+	if (git_odb_init_backend(&b->parent, GIT_ODB_BACKEND_VERSION) < 0) {
+		free(b);
+		return NULL;
+	}
+	b->parent.read = tar_odb_read;
+	b->parent.read_header = tar_odb_read_header;
+	b->parent.exists = tar_odb_exists;
+	b->parent.free = tar_odb_free;
+	b->handle = handle;
+
+	return &b->parent;
+}
+
+uintptr_t tar_odb_handle(git_odb_backend *backend)
+{
+	return ((tar_odb_backend *)backend)->handle;
+}
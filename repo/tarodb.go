@@ -0,0 +1,151 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+/*
+#cgo pkg-config: libgit2
+#include <stdlib.h>
+#include <string.h>
+#include "tarodb.h"
+*/
+import "C"
+
+import (
+	"errors"
+	"sync"
+	"unsafe"
+
+	g2g "github.com/libgit2/git2go"
+)
+
+// tarOdbPriority is the priority of the backends serving objects from tar
+// archives: above the priority of the backends reading objects from disk, so
+// that they are asked first.
+const tarOdbPriority = 10
+
+// tarOdbs maps the handles given to object database backends to the archives
+// they serve objects from, as Go pointers cannot be kept by C code.
+var tarOdbs = struct {
+	sync.Mutex
+	next    uintptr
+	handles map[uintptr]*tarObjects
+}{handles: make(map[uintptr]*tarObjects)}
+
+// addTarObjectsBackend makes the objects of a tar archive readable through
+// the object database of a repository.
+func addTarObjectsBackend(odb *g2g.Odb, objects *tarObjects) error {
+	tarOdbs.Lock()
+	tarOdbs.next++
+	handle := tarOdbs.next
+	tarOdbs.handles[handle] = objects
+	tarOdbs.Unlock()
+
+	backend := C.tar_odb_new(C.uintptr_t(handle))
+	if backend == nil {
+		tarOdbFreeHandle(handle)
+		return errors.New("cannot create tar object database backend")
+	}
+
+	// the object database owns the backend from now on and frees it, as
+	// does AddBackend on failure. NewOdbBackendFromC must take an
+	// unsafe.Pointer: a *C.git_odb_backend of this package is not one of
+	// git2go.
+	return odb.AddBackend(g2g.NewOdbBackendFromC(unsafe.Pointer(backend)), tarOdbPriority)
+}
+
+// tarOdbObjects returns the archive a backend serves objects from.
+func tarOdbObjects(backend *C.git_odb_backend) *tarObjects {
+	tarOdbs.Lock()
+	defer tarOdbs.Unlock()
+	return tarOdbs.handles[uintptr(C.tar_odb_handle(backend))]
+}
+
+// tarOdbFreeHandle forgets the archive a handle refers to.
+func tarOdbFreeHandle(handle uintptr) {
+	tarOdbs.Lock()
+	delete(tarOdbs.handles, handle)
+	tarOdbs.Unlock()
+}
+
+// tarOdbSetError reports an error to libgit2.
+func tarOdbSetError(err error) C.int {
+	if err == errObjectNotFound {
+		return C.GIT_ENOTFOUND
+	}
+
+	msg := C.CString(err.Error())
+	defer C.free(unsafe.Pointer(msg))
+	C.giterr_set_str(C.GITERR_ODB, msg)
+	return C.GIT_ERROR
+}
+
+// goOid converts a libgit2 object ID.
+func goOid(oid *C.git_oid) [20]byte {
+	var id [20]byte
+	copy(id[:], C.GoBytes(unsafe.Pointer(&oid.id[0]), 20))
+	return id
+}
+
+//export tarOdbRead
+func tarOdbRead(data *unsafe.Pointer, length *C.size_t, otype *C.git_otype, backend *C.git_odb_backend, oid *C.git_oid) C.int {
+	objects := tarOdbObjects(backend)
+	if objects == nil {
+		return C.GIT_ENOTFOUND
+	}
+
+	typ, content, err := objects.read(goOid(oid))
+	if err != nil {
+		return tarOdbSetError(err)
+	}
+
+	// libgit2 frees the buffer, which must be allocated through it
+	size := len(content)
+	if size == 0 {
+		size = 1
+	}
+	buf := C.git_odb_backend_malloc(backend, C.size_t(size))
+	if buf == nil {
+		return C.GIT_ERROR
+	}
+	if len(content) > 0 {
+		C.memcpy(buf, unsafe.Pointer(&content[0]), C.size_t(len(content)))
+	}
+
+	*data = buf
+	*length = C.size_t(len(content))
+	*otype = C.git_otype(typ)
+	return C.GIT_OK
+}
+
+//export tarOdbReadHeader
+func tarOdbReadHeader(length *C.size_t, otype *C.git_otype, backend *C.git_odb_backend, oid *C.git_oid) C.int {
+	objects := tarOdbObjects(backend)
+	if objects == nil {
+		return C.GIT_ENOTFOUND
+	}
+
+	typ, content, err := objects.read(goOid(oid))
+	if err != nil {
+		return tarOdbSetError(err)
+	}
+
+	*length = C.size_t(len(content))
+	*otype = C.git_otype(typ)
+	return C.GIT_OK
+}
+
+//export tarOdbExists
+func tarOdbExists(backend *C.git_odb_backend, oid *C.git_oid) C.int {
+	objects := tarOdbObjects(backend)
+	if objects == nil || !objects.exists(goOid(oid)) {
+		return 0
+	}
+	return 1
+}
+
+//export tarOdbFree
+func tarOdbFree(backend *C.git_odb_backend) {
+	tarOdbFreeHandle(uintptr(C.tar_odb_handle(backend)))
+}
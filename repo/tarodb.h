@@ -0,0 +1,21 @@
+/*
+ * Copyright 2014-2015 The DevMine authors. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ */
+
+#ifndef REPOTOOL_TARODB_H
+#define REPOTOOL_TARODB_H
+
+#include <stdint.h>
+#include <git2.h>
+#include <git2/sys/odb_backend.h>
+
+/* tar_odb_new creates an object database backend serving the objects of the
+ * tar archive registered under handle. */
+git_odb_backend *tar_odb_new(uintptr_t handle);
+
+/* tar_odb_handle returns the handle a backend was created with. */
+uintptr_t tar_odb_handle(git_odb_backend *backend);
+
+#endif
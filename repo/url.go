@@ -0,0 +1,114 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// NormalizeURL returns the canonical form of a git remote URL so that URLs
+// pointing to the same repository compare equal, whatever the protocol used.
+// SSH, git, HTTP(S) and scp-like URLs (user@host:path) are all turned into
+// the https://host/path.git form, the host being lowercased and user
+// information, default ports and trailing slashes being removed. Local paths
+// and file:// URLs are only cleaned.
+// If the URL cannot be parsed, it is returned unchanged.
+func NormalizeURL(rawurl string) string {
+	rawurl = strings.TrimSpace(rawurl)
+	if len(rawurl) == 0 {
+		return rawurl
+	}
+
+	if !strings.Contains(rawurl, "://") {
+		host, p, ok := splitSCPLikeURL(rawurl)
+		if !ok {
+			// local path
+			return path.Clean(rawurl)
+		}
+		return canonicalURL(host, p)
+	}
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "file":
+		return "file://" + path.Clean(u.Path)
+	case "http", "https":
+		host := u.Host
+		if h, port := splitHostPort(host); port == "80" || port == "443" {
+			host = h
+		}
+		return canonicalURL(host, u.Path)
+	case "ssh", "git", "git+ssh", "ssh+git":
+		host, _ := splitHostPort(u.Host)
+		return canonicalURL(host, u.Path)
+	}
+
+	return rawurl
+}
+
+// canonicalURL builds a canonical https URL from a host and a path.
+func canonicalURL(host, p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	p = strings.TrimSuffix(p, ".git")
+	return "https://" + strings.ToLower(host) + "/" + p + ".git"
+}
+
+// splitSCPLikeURL splits an scp-like URL ([user@]host:path) into its host
+// and path. It returns false if rawurl is not an scp-like URL.
+func splitSCPLikeURL(rawurl string) (string, string, bool) {
+	colon := strings.Index(rawurl, ":")
+	if colon <= 0 {
+		return "", "", false
+	}
+
+	// a slash before the colon means that this is a local path
+	if slash := strings.Index(rawurl, "/"); slash >= 0 && slash < colon {
+		return "", "", false
+	}
+
+	host := rawurl[:colon]
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	// a single letter followed by a colon is a windows drive letter
+	if len(host) == 1 {
+		return "", "", false
+	}
+
+	return host, rawurl[colon+1:], true
+}
+
+// splitHostPort splits a host[:port] string. Unlike net.SplitHostPort, a
+// missing port is not an error.
+func splitHostPort(hostport string) (string, string) {
+	colon := strings.LastIndex(hostport, ":")
+	if colon < 0 || strings.HasSuffix(hostport, "]") {
+		return hostport, ""
+	}
+	return hostport[:colon], hostport[colon+1:]
+}
+
+// rewriteURL applies url.<base>.insteadOf rules to rawurl. insteadOf maps
+// prefixes to their replacement. As git does, the longest matching prefix
+// wins.
+func rewriteURL(rawurl string, insteadOf map[string]string) string {
+	var best string
+	for prefix := range insteadOf {
+		if strings.HasPrefix(rawurl, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+
+	if len(best) == 0 {
+		return rawurl
+	}
+	return insteadOf[best] + strings.TrimPrefix(rawurl, best)
+}
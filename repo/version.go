@@ -0,0 +1,57 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionRe matches tag names holding a version number, possibly prefixed
+// by "v" or by a name followed by "-", "_" or "/" (eg "v1.2.3",
+// "release-1.2", "foo/1.0.0-rc.1+build.5").
+var versionRe = regexp.MustCompile(
+	`^(?:.*?[-_/])?[vV]?([0-9]+)\.([0-9]+)(?:\.([0-9]+))?(?:-([0-9A-Za-z.-]+))?(?:\+([0-9A-Za-z.-]+))?$`)
+
+// parseVersion extracts a semantic version from a tag name. The version is
+// normalized to the MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD] form, a missing
+// patch number being 0. It returns false if the name holds no version.
+func parseVersion(name string) (version string, prerelease bool, ok bool) {
+	m := versionRe.FindStringSubmatch(name)
+	if m == nil {
+		return "", false, false
+	}
+
+	nums := make([]string, 3)
+	for i, s := range m[1:4] {
+		if len(s) == 0 {
+			s = "0"
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return "", false, false
+		}
+		nums[i] = strconv.Itoa(n)
+	}
+	version = strings.Join(nums, ".")
+
+	for _, ids := range m[4:6] {
+		for _, id := range strings.Split(ids, ".") {
+			if len(ids) > 0 && len(id) == 0 {
+				return "", false, false
+			}
+		}
+	}
+	if len(m[4]) > 0 {
+		version += "-" + m[4]
+		prerelease = true
+	}
+	if len(m[5]) > 0 {
+		version += "+" + m[5]
+	}
+
+	return version, prerelease, true
+}
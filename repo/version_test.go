@@ -0,0 +1,44 @@
+// Copyright 2014-2015 The DevMine authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package repo
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    string
+		prerelease bool
+		ok         bool
+	}{
+		{"v1.2.3", "1.2.3", false, true},
+		{"V1.2.3", "1.2.3", false, true},
+		{"1.2", "1.2.0", false, true},
+		{"release-1.2", "1.2.0", false, true},
+		{"foo_2.0.1", "2.0.1", false, true},
+		{"foo/1.0.0-rc.1+build.5", "1.0.0-rc.1+build.5", true, true},
+		{"v01.02.03", "1.2.3", false, true},
+		{"v1.0.0-beta", "1.0.0-beta", true, true},
+		{"v1.0.0+20150101", "1.0.0+20150101", false, true},
+		{"my-project-v3.1-alpha.2", "3.1.0-alpha.2", true, true},
+		{"", "", false, false},
+		{"latest", "", false, false},
+		{"v1", "", false, false},
+		{"1.2.3.4", "", false, false},
+		{"v1.2.3-", "", false, false},
+		{"v1.2.3-rc..1", "", false, false},
+		{"v1.2.3+build.", "", false, false},
+		{"foo1.2.3", "", false, false},
+		{"v99999999999999999999.0", "", false, false},
+	}
+
+	for _, tt := range tests {
+		version, prerelease, ok := parseVersion(tt.name)
+		if version != tt.version || prerelease != tt.prerelease || ok != tt.ok {
+			t.Errorf("parseVersion(%q) = %q, %v, %v, want %q, %v, %v", tt.name,
+				version, prerelease, ok, tt.version, tt.prerelease, tt.ok)
+		}
+	}
+}